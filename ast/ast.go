@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"math/big"
 	"strings"
 
 	"github.com/valsov/gointerpreter/token"
@@ -10,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Span() token.Span // Source range covered by the node
 }
 
 type Statement interface {
@@ -25,6 +27,7 @@ type Expression interface {
 // Root node of the AST
 type Program struct {
 	Statements []Statement
+	Comments   map[Node][]*Comment // Only filled when the lexer scans comments, see Parser.ParseProgram
 }
 
 func (p *Program) String() string {
@@ -41,6 +44,26 @@ func (p *Program) TokenLiteral() string {
 	}
 	return p.Statements[0].TokenLiteral()
 }
+func (p *Program) Span() token.Span {
+	if len(p.Statements) <= 0 {
+		return token.Span{}
+	}
+	return extendSpan(p.Statements[0].Span(), p.Statements[len(p.Statements)-1])
+}
+
+type Comment struct {
+	Token token.Token // Literal holds the full comment, delimiters included
+}
+
+func (c *Comment) String() string {
+	return c.Token.Literal
+}
+func (c *Comment) TokenLiteral() string {
+	return c.Token.Literal
+}
+func (c *Comment) Span() token.Span {
+	return c.Token.Span
+}
 
 type LetStatement struct {
 	Token token.Token
@@ -61,6 +84,26 @@ func (ls *LetStatement) String() string {
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Span() token.Span {
+	return extendSpan(ls.Token.Span, ls.Name, ls.Value)
+}
+
+// Placeholder for a statement that could not be parsed, covering the source skipped by the parser
+type BadStatement struct {
+	Token token.Token // First token of the statement
+	End   token.Position
+}
+
+func (bs *BadStatement) statementNode() {}
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+func (bs *BadStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BadStatement) Span() token.Span {
+	return token.Span{Start: bs.Token.Span.Start, End: bs.End}
+}
 
 type Identifier struct {
 	Token token.Token
@@ -74,6 +117,9 @@ func (id *Identifier) String() string {
 func (id *Identifier) TokenLiteral() string {
 	return id.Token.Literal
 }
+func (id *Identifier) Span() token.Span {
+	return id.Token.Span
+}
 
 type ReturnStatement struct {
 	Token       token.Token
@@ -93,6 +139,9 @@ func (rs *ReturnStatement) String() string {
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Span() token.Span {
+	return extendSpan(rs.Token.Span, rs.ReturnValue)
+}
 
 type ExpressionStatement struct {
 	Token      token.Token
@@ -109,10 +158,14 @@ func (es *ExpressionStatement) String() string {
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Span() token.Span {
+	return extendSpan(es.Token.Span, es.Expression)
+}
 
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // Set instead of Value when the literal doesn't fit in an int64
 }
 
 func (il *IntegerLiteral) expresionNode() {}
@@ -122,6 +175,25 @@ func (il *IntegerLiteral) String() string {
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Span() token.Span {
+	return il.Token.Span
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expresionNode() {}
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) Span() token.Span {
+	return fl.Token.Span
+}
 
 type PrefixExpression struct {
 	Token    token.Token // Operator token
@@ -136,6 +208,26 @@ func (pe *PrefixExpression) String() string {
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+func (pe *PrefixExpression) Span() token.Span {
+	return extendSpan(pe.Token.Span, pe.Right)
+}
+
+// Expands an array into call arguments or array elements, or a hash into the entries of a hash literal
+type SpreadExpression struct {
+	Token token.Token // ...
+	Value Expression
+}
+
+func (se *SpreadExpression) expresionNode() {}
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+func (se *SpreadExpression) Span() token.Span {
+	return extendSpan(se.Token.Span, se.Value)
+}
 
 type InfixExpression struct {
 	Token    token.Token // Operator token
@@ -151,6 +243,52 @@ func (ie *InfixExpression) String() string {
 func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *InfixExpression) Span() token.Span {
+	return extendSpan(startSpan(ie.Left, ie.Token), ie.Right)
+}
+
+type AssignExpression struct {
+	Token    token.Token // Assignment operator
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expresionNode() {}
+func (ae *AssignExpression) String() string {
+	return fmt.Sprintf("(%s %s %s)", ae.Target.String(), ae.Operator, ae.Value.String())
+}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Span() token.Span {
+	return extendSpan(startSpan(ae.Target, ae.Token), ae.Value)
+}
+
+// Increment or decrement of a variable: ++x, --x, x++ or x--
+type UpdateExpression struct {
+	Token    token.Token // ++ or --
+	Operator string
+	Target   Expression
+	Prefix   bool
+}
+
+func (ue *UpdateExpression) expresionNode() {}
+func (ue *UpdateExpression) String() string {
+	if ue.Prefix {
+		return fmt.Sprintf("(%s%s)", ue.Operator, ue.Target.String())
+	}
+	return fmt.Sprintf("(%s%s)", ue.Target.String(), ue.Operator)
+}
+func (ue *UpdateExpression) TokenLiteral() string {
+	return ue.Token.Literal
+}
+func (ue *UpdateExpression) Span() token.Span {
+	if ue.Prefix {
+		return extendSpan(ue.Token.Span, ue.Target)
+	}
+	return startSpan(ue.Target, ue.Token)
+}
 
 type Boolean struct {
 	Token token.Token
@@ -164,12 +302,15 @@ func (b *Boolean) String() string {
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
+func (b *Boolean) Span() token.Span {
+	return b.Token.Span
+}
 
 type IfExpression struct {
 	Token       token.Token // if
 	Condition   Expression
 	Consequence *BlockStatement
-	Alternative *BlockStatement
+	Alternative *BlockStatement // For else if, the block only holds the nested IfExpression
 }
 
 func (ie *IfExpression) expresionNode() {}
@@ -178,17 +319,46 @@ func (ie *IfExpression) String() string {
 	sb.WriteString(fmt.Sprintf("if %s %s", ie.Condition.String(), ie.Consequence.String()))
 
 	if ie.Alternative != nil {
-		sb.WriteString(fmt.Sprintf("else %s", ie.Alternative.String()))
+		sb.WriteString(fmt.Sprintf(" else %s", ie.Alternative.String()))
 	}
 	return sb.String()
 }
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Span() token.Span {
+	span := extendSpan(ie.Token.Span, ie.Condition)
+	if ie.Consequence != nil {
+		span = extendSpan(span, ie.Consequence)
+	}
+	if ie.Alternative != nil {
+		span = extendSpan(span, ie.Alternative)
+	}
+	return span
+}
+
+type ConditionalExpression struct {
+	Token       token.Token // ?
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expresionNode() {}
+func (ce *ConditionalExpression) String() string {
+	return fmt.Sprintf("(%s ? %s : %s)", ce.Condition.String(), ce.Consequence.String(), ce.Alternative.String())
+}
+func (ce *ConditionalExpression) TokenLiteral() string {
+	return ce.Token.Literal
+}
+func (ce *ConditionalExpression) Span() token.Span {
+	return extendSpan(startSpan(ce.Condition, ce.Token), ce.Consequence, ce.Alternative)
+}
 
 type BlockStatement struct {
 	Token      token.Token // {
 	Statements []Statement
+	End        token.Position // End of the closing }, invalid when the block wasn't closed
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -202,29 +372,179 @@ func (bs *BlockStatement) String() string {
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Span() token.Span {
+	span := bs.Token.Span
+	for _, s := range bs.Statements {
+		span = extendSpan(span, s)
+	}
+	return extendSpanTo(span, bs.End)
+}
+
+type WhileStatement struct {
+	Token     token.Token // while
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) String() string {
+	return fmt.Sprintf("while %s %s", ws.Condition.String(), ws.Body.String())
+}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+func (ws *WhileStatement) Span() token.Span {
+	span := extendSpan(ws.Token.Span, ws.Condition)
+	if ws.Body != nil {
+		span = extendSpan(span, ws.Body)
+	}
+	return span
+}
+
+// C-style loop, all the clauses are optional
+type ForStatement struct {
+	Token     token.Token // for
+	Init      Statement
+	Condition Expression
+	Update    Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) String() string {
+	clauses := make([]string, 3)
+	if fs.Init != nil {
+		clauses[0] = strings.TrimSuffix(fs.Init.String(), ";")
+	}
+	if fs.Condition != nil {
+		clauses[1] = fs.Condition.String()
+	}
+	if fs.Update != nil {
+		clauses[2] = fs.Update.String()
+	}
+	return fmt.Sprintf("for (%s) %s", strings.Join(clauses, "; "), fs.Body.String())
+}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForStatement) Span() token.Span {
+	span := extendSpan(fs.Token.Span, fs.Init, fs.Condition, fs.Update)
+	if fs.Body != nil {
+		span = extendSpan(span, fs.Body)
+	}
+	return span
+}
+
+// Iteration over a collection: for (x in iterable) or for (k, v in iterable)
+type ForInStatement struct {
+	Token    token.Token   // for
+	Names    []*Identifier // One or two loop variables
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode() {}
+func (fs *ForInStatement) String() string {
+	names := make([]string, len(fs.Names))
+	for i, name := range fs.Names {
+		names[i] = name.String()
+	}
+	return fmt.Sprintf("for (%s in %s) %s", strings.Join(names, ", "), fs.Iterable.String(), fs.Body.String())
+}
+func (fs *ForInStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForInStatement) Span() token.Span {
+	span := extendSpan(fs.Token.Span, fs.Iterable)
+	if fs.Body != nil {
+		span = extendSpan(span, fs.Body)
+	}
+	return span
+}
+
+type BreakStatement struct {
+	Token token.Token // break
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) String() string {
+	return bs.TokenLiteral() + ";"
+}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Span() token.Span {
+	return bs.Token.Span
+}
+
+type ContinueStatement struct {
+	Token token.Token // continue
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) String() string {
+	return cs.TokenLiteral() + ";"
+}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Span() token.Span {
+	return cs.Token.Span
+}
 
 type FunctionLiteral struct {
 	Token      token.Token // fn
 	Parameters []*Identifier
+	Defaults   []Expression // Default value of each parameter, nil for the required ones
+	Rest       *Identifier  // Collects the extra arguments, nil when the function has a fixed arity
 	Body       *BlockStatement
 }
 
 func (fl *FunctionLiteral) expresionNode() {}
 func (fl *FunctionLiteral) String() string {
-	parametersStr := make([]string, len(fl.Parameters))
-	for i, s := range fl.Parameters {
-		parametersStr[i] = s.String()
-	}
-	return fmt.Sprintf("%s(%s) %s", fl.TokenLiteral(), strings.Join(parametersStr, ", "), fl.Body.String())
+	return fmt.Sprintf("%s(%s) %s", fl.TokenLiteral(), FormatParameters(fl.Parameters, fl.Defaults, fl.Rest), fl.Body.String())
 }
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Span() token.Span {
+	span := fl.Token.Span
+	for _, p := range fl.Parameters {
+		span = extendSpan(span, p)
+	}
+	for _, d := range fl.Defaults {
+		span = extendSpan(span, d)
+	}
+	if fl.Rest != nil {
+		span = extendSpan(span, fl.Rest)
+	}
+	if fl.Body != nil {
+		span = extendSpan(span, fl.Body)
+	}
+	return span
+}
+
+// Format a parameter list as written in source: "a, b = 10, ...rest"
+func FormatParameters(parameters []*Identifier, defaults []Expression, rest *Identifier) string {
+	parametersStr := make([]string, 0, len(parameters)+1)
+	for i, p := range parameters {
+		if i < len(defaults) && defaults[i] != nil {
+			parametersStr = append(parametersStr, fmt.Sprintf("%s = %s", p.String(), defaults[i].String()))
+		} else {
+			parametersStr = append(parametersStr, p.String())
+		}
+	}
+	if rest != nil {
+		parametersStr = append(parametersStr, "..."+rest.String())
+	}
+	return strings.Join(parametersStr, ", ")
+}
 
 type CallExpression struct {
 	Token     token.Token // (
 	Function  Expression
 	Arguments []Expression
+	End       token.Position // End of the closing )
 }
 
 func (ce *CallExpression) expresionNode() {}
@@ -238,6 +558,13 @@ func (ce *CallExpression) String() string {
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Span() token.Span {
+	span := startSpan(ce.Function, ce.Token)
+	for _, arg := range ce.Arguments {
+		span = extendSpan(span, arg)
+	}
+	return extendSpanTo(span, ce.End)
+}
 
 type StringLiteral struct {
 	Token token.Token
@@ -251,10 +578,42 @@ func (s *StringLiteral) String() string {
 func (s *StringLiteral) TokenLiteral() string {
 	return s.Token.Literal
 }
+func (s *StringLiteral) Span() token.Span {
+	return s.Token.Span
+}
+
+// String with embedded expressions: "total: ${a + b}"
+type InterpolatedString struct {
+	Token token.Token  // TEMPLATE_HEAD
+	Parts []Expression // Text segments are StringLiterals, the others are the embedded expressions
+}
+
+func (is *InterpolatedString) expresionNode() {}
+func (is *InterpolatedString) String() string {
+	sb := strings.Builder{}
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			sb.WriteString(text.Value)
+		} else {
+			sb.WriteString("${" + part.String() + "}")
+		}
+	}
+	return sb.String()
+}
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *InterpolatedString) Span() token.Span {
+	if len(is.Parts) == 0 {
+		return is.Token.Span
+	}
+	return extendSpan(is.Token.Span, is.Parts[len(is.Parts)-1])
+}
 
 type ArrayLiteral struct {
 	Token    token.Token // [
 	Elements []Expression
+	End      token.Position // End of the closing ]
 }
 
 func (al *ArrayLiteral) expresionNode() {}
@@ -268,11 +627,19 @@ func (al *ArrayLiteral) String() string {
 func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
+func (al *ArrayLiteral) Span() token.Span {
+	span := al.Token.Span
+	for _, elem := range al.Elements {
+		span = extendSpan(span, elem)
+	}
+	return extendSpanTo(span, al.End)
+}
 
 type IndexExpression struct {
 	Token token.Token // [
 	Left  Expression
 	Index Expression
+	End   token.Position // End of the closing ]
 }
 
 func (ie *IndexExpression) expresionNode() {}
@@ -282,25 +649,70 @@ func (ie *IndexExpression) String() string {
 func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IndexExpression) Span() token.Span {
+	return extendSpanTo(extendSpan(startSpan(ie.Left, ie.Token), ie.Index), ie.End)
+}
 
 type HashLiteral struct {
 	Token token.Token // {
 	Pairs []ExpressionPair
+	End   token.Position // End of the closing }
 }
 
 func (hl *HashLiteral) expresionNode() {}
 func (hl *HashLiteral) String() string {
 	pairs := make([]string, len(hl.Pairs))
 	for i, pair := range hl.Pairs {
+		if pair.Value == nil {
+			pairs[i] = pair.Key.String()
+			continue
+		}
 		pairs[i] = fmt.Sprintf("%s:%s", pair.Key.String(), pair.Value.String())
-		i++
 	}
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
 func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
+func (hl *HashLiteral) Span() token.Span {
+	span := hl.Token.Span
+	for _, pair := range hl.Pairs {
+		span = extendSpan(span, pair.Key, pair.Value)
+	}
+	return extendSpanTo(span, hl.End)
+}
 
+// Entry of a hash literal. A spread entry has a *SpreadExpression key and a nil value
 type ExpressionPair struct {
 	Key, Value Expression
 }
+
+// Extend a span so that it ends after the given nodes, nil nodes are ignored
+func extendSpan(span token.Span, nodes ...Node) token.Span {
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		end := node.Span().End
+		if end.Line > span.End.Line || end.Line == span.End.Line && end.Column > span.End.Column {
+			span.End = end
+		}
+	}
+	return span
+}
+
+// Extend a span so that it ends at the given position, an invalid position is ignored
+func extendSpanTo(span token.Span, end token.Position) token.Span {
+	if end.IsValid() && span.End.Before(end) {
+		span.End = end
+	}
+	return span
+}
+
+// Span starting at the leftmost node of an expression, falling back on the token when the node is missing
+func startSpan(node Node, tok token.Token) token.Span {
+	if node == nil {
+		return tok.Span
+	}
+	return token.Span{Start: node.Span().Start, End: tok.Span.End}
+}
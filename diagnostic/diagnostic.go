@@ -0,0 +1,123 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/valsov/gointerpreter/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// Stable identifier of a kind of diagnostic, tools can match on it instead of the message
+type Code string
+
+const (
+	UnexpectedToken    Code = "unexpected-token"
+	ExpectedExpression Code = "expected-expression"
+	InvalidInteger     Code = "invalid-integer"
+	InvalidFloat       Code = "invalid-float"
+	IllegalToken       Code = "illegal-token"
+	InvalidTarget      Code = "invalid-target"
+	OutsideLoop        Code = "outside-loop"
+	InvalidParameter   Code = "invalid-parameter"
+	ReadError          Code = "read-error"
+)
+
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Span     token.Span
+	Expected []token.TokenType // Token types that were accepted at this location, if relevant
+	Found    token.TokenType   // Token type that was found instead, if relevant
+	Notes    []string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+// Write the diagnostic to out, quoting the offending source line with a caret underline.
+// The source may be empty when it is not available, in which case only the message and location are written
+func Render(out io.Writer, source string, d Diagnostic) {
+	fmt.Fprintf(out, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	start := d.Span.Start
+	gutter := strings.Repeat(" ", len(fmt.Sprint(start.Line)))
+	fmt.Fprintf(out, "%s--> %s\n", gutter, start)
+
+	if line, ok := sourceLine(source, start.Line); ok {
+		fmt.Fprintf(out, "%s |\n", gutter)
+		fmt.Fprintf(out, "%d | %s\n", start.Line, line)
+		fmt.Fprintf(out, "%s | %s\n", gutter, underline(line, d.Span))
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(out, "%s = note: %s\n", gutter, note)
+	}
+}
+
+// Render every diagnostic in order, separated by blank lines
+func RenderAll(out io.Writer, source string, diagnostics []Diagnostic) {
+	for i, d := range diagnostics {
+		if i > 0 {
+			io.WriteString(out, "\n")
+		}
+		Render(out, source, d)
+	}
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if source == "" || line <= 0 {
+		return "", false
+	}
+
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// Build the caret line pointing at the span, tabs of the source are kept so the carets stay aligned
+func underline(line string, span token.Span) string {
+	sb := strings.Builder{}
+	runes := []rune(line)
+	for i := 0; i < span.Start.Column-1; i++ {
+		if i < len(runes) && runes[i] == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	} else if span.End.Line > span.Start.Line && len(runes) >= span.Start.Column {
+		width = len(runes) - span.Start.Column + 1 // Multiline span: underline up to the end of the first line
+	}
+	sb.WriteString(strings.Repeat("^", width))
+	return sb.String()
+}
@@ -0,0 +1,92 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/valsov/gointerpreter/token"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		source   string
+		d        Diagnostic
+		expected string
+	}{
+		{
+			"let x = (1 + 2",
+			Diagnostic{
+				Severity: Error,
+				Code:     UnexpectedToken,
+				Message:  "expected next token to be ), got EOF instead",
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 15},
+					End:   token.Position{Line: 1, Column: 15},
+				},
+			},
+			"error[unexpected-token]: expected next token to be ), got EOF instead\n" +
+				" --> 1:15\n" +
+				"  |\n" +
+				"1 | let x = (1 + 2\n" +
+				"  |               ^\n",
+		},
+		{
+			"let a = 1;\n\tlet = 10;",
+			Diagnostic{
+				Severity: Error,
+				Code:     UnexpectedToken,
+				Message:  "expected next token to be IDENT, got = instead",
+				Span: token.Span{
+					Start: token.Position{Filename: "main.mk", Line: 2, Column: 6},
+					End:   token.Position{Filename: "main.mk", Line: 2, Column: 7},
+				},
+				Notes: []string{"a let statement binds a value to a name"},
+			},
+			"error[unexpected-token]: expected next token to be IDENT, got = instead\n" +
+				" --> main.mk:2:6\n" +
+				"  |\n" +
+				"2 | \tlet = 10;\n" +
+				"  | \t    ^\n" +
+				"  = note: a let statement binds a value to a name\n",
+		},
+		{
+			"",
+			Diagnostic{
+				Severity: Warning,
+				Code:     IllegalToken,
+				Message:  "unexpected character '@'",
+				Span: token.Span{
+					Start: token.Position{Line: 12, Column: 3},
+					End:   token.Position{Line: 12, Column: 4},
+				},
+			},
+			"warning[illegal-token]: unexpected character '@'\n" +
+				"  --> 12:3\n",
+		},
+		{
+			"foo(bar, bazz)",
+			Diagnostic{
+				Severity: Error,
+				Code:     ExpectedExpression,
+				Message:  "wide span",
+				Span: token.Span{
+					Start: token.Position{Line: 1, Column: 10},
+					End:   token.Position{Line: 1, Column: 14},
+				},
+			},
+			"error[expected-expression]: wide span\n" +
+				" --> 1:10\n" +
+				"  |\n" +
+				"1 | foo(bar, bazz)\n" +
+				"  |          ^^^^\n",
+		},
+	}
+
+	for i, tt := range tests {
+		out := bytes.Buffer{}
+		Render(&out, tt.source, tt.d)
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] - wrong rendering. expected=\n%s\ngot=\n%s", i, tt.expected, out.String())
+		}
+	}
+}
@@ -8,11 +8,9 @@ import (
 
 var builtins = map[string]*object.Builtin{
 	"len": {
+		Name:       "len",
+		Parameters: []string{"value"},
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-
 			switch arg := args[0].(type) {
 			case *object.String:
 				return &object.Integer{Value: int64(len(arg.Value))}
@@ -24,11 +22,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"first": {
+		Name:       "first",
+		Parameters: []string{"array"},
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
-					len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
 				return newError("argument to `first` must be ARRAY, got %s",
 					args[0].Type())
@@ -43,10 +39,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": {
+		Name:       "last",
+		Parameters: []string{"array"},
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
 				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
 			}
@@ -61,10 +56,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": {
+		Name:       "rest",
+		Parameters: []string{"array"},
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
 				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
 			}
@@ -81,10 +75,9 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": {
+		Name:       "push",
+		Parameters: []string{"array", "element"},
 		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2", len(args))
-			}
 			if args[0].Type() != object.ARRAY_OBJ {
 				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
 			}
@@ -100,6 +93,8 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"print": {
+		Name:     "print",
+		Variadic: true,
 		Fn: func(args ...object.Object) object.Object {
 			for _, arg := range args {
 				fmt.Println(arg.Inspect())
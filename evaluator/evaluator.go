@@ -2,18 +2,44 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
 
 	"github.com/valsov/gointerpreter/ast"
 	"github.com/valsov/gointerpreter/object"
+	"github.com/valsov/gointerpreter/token"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Deep recursion is reported as an error before it exhausts the Go stack, which can't be recovered from
+const maxCallDepth = 10000
+
+var callDepth int // Number of user function calls being evaluated
+
+// Errors get the span of the innermost node that raised them. A Go panic during the evaluation is turned into an
+// error instead of crashing the host
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+		}
+		if errObj, ok := result.(*object.Error); ok && !errObj.Span.Start.IsValid() {
+			errObj.Span = node.Span()
+		}
+	}()
+
+	return eval(node, env)
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
@@ -21,82 +47,115 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isInterruption(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isInterruption(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isInterruption(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.Boolean:
 		return nativeBoolToBoolean(node.Value)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.ConditionalExpression:
+		return evalConditionalExpression(node, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isInterruption(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isInterruption(val) {
 			return val
 		}
+		if function, ok := val.(*object.Function); ok && function.Name == "" {
+			function.Name = node.Name.Value
+		}
 		env.Set(node.Name.Value, val)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+	case *ast.UpdateExpression:
+		return evalUpdateExpression(node, env)
 	case *ast.FunctionLiteral:
 		return &object.Function{
 			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
 			Body:       node.Body,
 			Env:        env,
 		}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isInterruption(function) {
 			return function
 		}
 
 		parameters := evalExpressions(node.Arguments, env)
-		if len(parameters) == 1 && isError(parameters[0]) {
+		if len(parameters) == 1 && isInterruption(parameters[0]) {
 			return parameters[0]
 		}
 
-		return applyFunction(function, parameters)
+		return applyFunction(function, parameters, node.Span().Start)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isInterruption(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isInterruption(left) {
 			return left
 		}
 
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isInterruption(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.BadStatement:
+		return newError("cannot evaluate a statement containing syntax errors")
 	}
 
 	return nil
@@ -122,8 +181,11 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	for _, statement := range block.Statements {
 		obj = Eval(statement, env)
 
-		if obj != nil && (obj.Type() == object.RETURN_VALUE_OBJ || obj.Type() == object.ERROR_OBJ) {
-			return obj
+		if obj != nil {
+			switch obj.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return obj
+			}
 		}
 	}
 	return obj
@@ -142,6 +204,8 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitwiseNotPrefixOperatorExpression(right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -149,11 +213,16 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
+	case isNumber(left) && isNumber(right) && left.Type() != right.Type():
+		// Mixed integer and float operands are promoted to float
+		return evalFloatInfixExpression(operator, toFloat(left), toFloat(right))
 	case left.Type() != right.Type():
 		// Expect same type from left and right
 		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	case left.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.FLOAT_OBJ:
+		return evalFloatInfixExpression(operator, left.(*object.Float), right.(*object.Float))
 	case left.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
@@ -166,6 +235,26 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// Short-circuit evaluation, the right operand is only evaluated if the left one doesn't decide the result
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isInterruption(left) {
+		return left
+	}
+	if node.Operator == "&&" && !isTrue(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTrue(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+	if isInterruption(right) {
+		return right
+	}
+	return nativeBoolToBoolean(isTrue(right))
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -180,33 +269,190 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.NewInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value} // Apply minus here
+	case *object.BigInteger:
+		return object.NewInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
+}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value} // Apply minus here
+func evalBitwiseNotPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInteger:
+		return object.NewInteger(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
 }
 
+// Operations are checked for overflow, results that don't fit in an int64 are computed again as big integers
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	leftInteger, leftOk := left.(*object.Integer)
+	rightInteger, rightOk := right.(*object.Integer)
+	if rightOk && rightInteger.Value == 0 && (operator == "/" || operator == "%") {
+		// Big integers are never zero, checking the Integer is enough
+		return newError("division by zero: %s %s %s", left.Type(), operator, right.Type())
+	}
+	if !leftOk || !rightOk {
+		return evalBigIntegerInfixExpression(operator, toBigInt(left), toBigInt(right))
+	}
+	leftValue := leftInteger.Value
+	rightValue := rightInteger.Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
+		if sum := leftValue + rightValue; (sum > leftValue) == (rightValue > 0) {
+			return &object.Integer{Value: sum}
+		}
 	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
+		if difference := leftValue - rightValue; (difference < leftValue) == (rightValue > 0) {
+			return &object.Integer{Value: difference}
+		}
 	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
+		if product, ok := multiplyInt64(leftValue, rightValue); ok {
+			return &object.Integer{Value: product}
+		}
 	case "%":
 		return &object.Integer{Value: leftValue % rightValue}
 	case "/":
-		return &object.Integer{Value: leftValue / rightValue}
+		if leftValue != math.MinInt64 || rightValue != -1 {
+			return &object.Integer{Value: leftValue / rightValue}
+		}
+	case "&":
+		return &object.Integer{Value: leftValue & rightValue}
+	case "|":
+		return &object.Integer{Value: leftValue | rightValue}
+	case "^":
+		return &object.Integer{Value: leftValue ^ rightValue}
+	case "<<", ">>":
+		if rightValue < 0 {
+			return newError("negative shift count: %d", rightValue)
+		}
+		if operator == ">>" {
+			return &object.Integer{Value: leftValue >> rightValue}
+		}
+		if rightValue < 64 && (leftValue<<rightValue)>>rightValue == leftValue {
+			return &object.Integer{Value: leftValue << rightValue}
+		}
 	case "<":
 		return nativeBoolToBoolean(leftValue < rightValue)
 	case ">":
 		return nativeBoolToBoolean(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBoolean(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBoolean(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBoolean(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBoolean(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	// The result overflows an int64
+	return evalBigIntegerInfixExpression(operator, big.NewInt(leftValue), big.NewInt(rightValue))
+}
+
+// Returns false if the product overflows an int64
+func multiplyInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	product := a * b
+	return product, product/b == a
+}
+
+// Largest left shift allowed on big integers, prevents allocating huge results
+const maxShiftCount = 1 << 20
+
+func evalBigIntegerInfixExpression(operator string, left, right *big.Int) object.Object {
+	switch operator {
+	case "+":
+		return object.NewInteger(new(big.Int).Add(left, right))
+	case "-":
+		return object.NewInteger(new(big.Int).Sub(left, right))
+	case "*":
+		return object.NewInteger(new(big.Int).Mul(left, right))
+	case "%":
+		return object.NewInteger(new(big.Int).Rem(left, right))
+	case "/":
+		return object.NewInteger(new(big.Int).Quo(left, right))
+	case "&":
+		return object.NewInteger(new(big.Int).And(left, right))
+	case "|":
+		return object.NewInteger(new(big.Int).Or(left, right))
+	case "^":
+		return object.NewInteger(new(big.Int).Xor(left, right))
+	case "<<", ">>":
+		if right.Sign() < 0 {
+			return newError("negative shift count: %s", right)
+		}
+		if operator == ">>" {
+			// Shifting by the bit length or more always gives 0 or -1
+			count := uint(left.BitLen())
+			if right.IsUint64() && right.Uint64() < uint64(count) {
+				count = uint(right.Uint64())
+			}
+			return object.NewInteger(new(big.Int).Rsh(left, count))
+		}
+		if !right.IsInt64() || right.Int64() > maxShiftCount {
+			return newError("shift count too large: %s", right)
+		}
+		return object.NewInteger(new(big.Int).Lsh(left, uint(right.Int64())))
+	case "<":
+		return nativeBoolToBoolean(left.Cmp(right) < 0)
+	case ">":
+		return nativeBoolToBoolean(left.Cmp(right) > 0)
+	case "<=":
+		return nativeBoolToBoolean(left.Cmp(right) <= 0)
+	case ">=":
+		return nativeBoolToBoolean(left.Cmp(right) >= 0)
+	case "==":
+		return nativeBoolToBoolean(left.Cmp(right) == 0)
+	case "!=":
+		return nativeBoolToBoolean(left.Cmp(right) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", object.INTEGER_OBJ, operator, object.INTEGER_OBJ)
+	}
+}
+
+func evalFloatInfixExpression(operator string, left, right *object.Float) object.Object {
+	leftValue := left.Value
+	rightValue := right.Value
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
+	case "<":
+		return nativeBoolToBoolean(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBoolean(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBoolean(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBoolean(leftValue >= rightValue)
 	case "==":
 		return nativeBoolToBoolean(leftValue == rightValue)
 	case "!=":
@@ -228,7 +474,7 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 
 func evalIfExpression(ifExp *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ifExp.Condition, env)
-	if isError(condition) {
+	if isInterruption(condition) {
 		return condition
 	}
 
@@ -241,6 +487,127 @@ func evalIfExpression(ifExp *ast.IfExpression, env *object.Environment) object.O
 	}
 }
 
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTrue(condition) {
+			return NULL
+		}
+
+		if result, stop := evalLoopBody(node.Body, env); stop {
+			return result
+		}
+	}
+}
+
+// The init clause is bound in an environment enclosing the whole loop
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+	if node.Init != nil {
+		init := Eval(node.Init, loopEnv)
+		if isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if node.Condition != nil {
+			condition := Eval(node.Condition, loopEnv)
+			if isError(condition) {
+				return condition
+			}
+			if !isTrue(condition) {
+				return NULL
+			}
+		}
+
+		if result, stop := evalLoopBody(node.Body, loopEnv); stop {
+			return result
+		}
+
+		if node.Update != nil {
+			update := Eval(node.Update, loopEnv)
+			if isError(update) {
+				return update
+			}
+		}
+	}
+}
+
+// With a single variable, it is bound to the array elements, the hash keys or the string chars. With two variables,
+// the first one is bound to the index or the key. Each iteration gets its own environment, so closures created in
+// the body capture the values of their iteration
+func evalForInStatement(node *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isInterruption(iterable) {
+		return iterable
+	}
+
+	var entries []object.HashPair // Key is the index or the hash key, Value is the element
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, elem := range iterable.Elements {
+			entries = append(entries, object.HashPair{Key: &object.Integer{Value: int64(i)}, Value: elem})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.OrderedPairs() {
+			entries = append(entries, object.HashPair{Key: pair.Key, Value: pair.Key})
+			if len(node.Names) == 2 {
+				entries[len(entries)-1].Value = pair.Value
+			}
+		}
+	case *object.String:
+		for i, ch := range []rune(iterable.Value) {
+			entries = append(entries, object.HashPair{Key: &object.Integer{Value: int64(i)}, Value: &object.String{Value: string(ch)}})
+		}
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for _, entry := range entries {
+		iterationEnv := object.NewEnclosedEnvironment(env)
+		if len(node.Names) == 2 {
+			iterationEnv.Set(node.Names[0].Value, entry.Key)
+			iterationEnv.Set(node.Names[1].Value, entry.Value)
+		} else {
+			iterationEnv.Set(node.Names[0].Value, entry.Value)
+		}
+
+		if result, stop := evalLoopBody(node.Body, iterationEnv); stop {
+			return result
+		}
+	}
+	return NULL
+}
+
+// Evaluate one iteration, returns true with the result of the whole loop when it must stop
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	switch result := Eval(body, env).(type) {
+	case *object.Break:
+		return NULL, true
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// Only the selected branch is evaluated
+func evalConditionalExpression(node *ast.ConditionalExpression, env *object.Environment) object.Object {
+	condition := Eval(node.Condition, env)
+	if isInterruption(condition) {
+		return condition
+	}
+
+	if isTrue(condition) {
+		return Eval(node.Consequence, env)
+	}
+	return Eval(node.Alternative, env)
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 
 	if val, ok := env.Get(node.Value); ok {
@@ -254,11 +621,189 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: %s", node.Value)
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	ref, errObj := resolveReference(node.Target, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	value := Eval(node.Value, env)
+	if isInterruption(value) {
+		return value
+	}
+
+	if node.Operator != "=" {
+		// Compound assignment: apply the operator preceding '=' to the current value
+		current, errObj := ref.load()
+		if errObj != nil {
+			return errObj
+		}
+
+		value = evalInfixExpression(strings.TrimSuffix(node.Operator, "="), current, value)
+		if isError(value) {
+			return value
+		}
+	}
+
+	if errObj := ref.store(value); errObj != nil {
+		return errObj
+	}
+	return value
+}
+
+// Prefix forms evaluate to the updated value, postfix forms to the value before the update
+func evalUpdateExpression(node *ast.UpdateExpression, env *object.Environment) object.Object {
+	ref, errObj := resolveReference(node.Target, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	current, errObj := ref.load()
+	if errObj != nil {
+		return errObj
+	}
+
+	if !isNumber(current) {
+		if node.Prefix {
+			return newError("unknown operator: %s%s", node.Operator, current.Type())
+		}
+		return newError("unknown operator: %s%s", current.Type(), node.Operator)
+	}
+
+	result := evalInfixExpression(node.Operator[:1], current, &object.Integer{Value: 1})
+	if isError(result) {
+		return result
+	}
+	if errObj := ref.store(result); errObj != nil {
+		return errObj
+	}
+
+	if node.Prefix {
+		return result
+	}
+	return current
+}
+
+// Storage location targeted by an assignment
+type reference struct {
+	load  func() (object.Object, *object.Error)
+	store func(object.Object) *object.Error
+}
+
+// Evaluate the operands of an assignment target once, and return the location it designates
+func resolveReference(target ast.Expression, env *object.Environment) (*reference, *object.Error) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		return identifierReference(target.Value, env), nil
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return nil, left.(*object.Error)
+		}
+
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return nil, index.(*object.Error)
+		}
+
+		switch left := left.(type) {
+		case *object.Array:
+			return arrayElementReference(left, index)
+		case *object.Hash:
+			return hashEntryReference(left, index)
+		default:
+			return nil, newError("index assignment not supported: %s", left.Type())
+		}
+	default:
+		return nil, newError("cannot assign to %s", target.String())
+	}
+}
+
+// Bindings are updated in the environment defining them, assigning an undeclared name is an error
+func identifierReference(name string, env *object.Environment) *reference {
+	return &reference{
+		load: func() (object.Object, *object.Error) {
+			if val, ok := env.Get(name); ok {
+				return val, nil
+			}
+			return nil, newError("identifier not found: %s", name)
+		},
+		store: func(value object.Object) *object.Error {
+			if !env.Assign(name, value) {
+				return newError("assignment to undeclared identifier: %s", name)
+			}
+			return nil
+		},
+	}
+}
+
+func arrayElementReference(array *object.Array, index object.Object) (*reference, *object.Error) {
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		if index.Type() == object.INTEGER_OBJ {
+			// Big integers can't be valid indexes
+			return nil, newError("index out of range: %s with length %d", index.Inspect(), len(array.Elements))
+		}
+		return nil, newError("array index must be INTEGER, got %s", index.Type())
+	}
+
+	i := integer.Value
+	if i < 0 || i > int64(len(array.Elements))-1 {
+		return nil, newError("index out of range: %d with length %d", i, len(array.Elements))
+	}
+
+	return &reference{
+		load: func() (object.Object, *object.Error) {
+			return array.Elements[i], nil
+		},
+		store: func(value object.Object) *object.Error {
+			array.Elements[i] = value
+			return nil
+		},
+	}, nil
+}
+
+func hashEntryReference(hash *object.Hash, key object.Object) (*reference, *object.Error) {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return nil, newError("unusable as hash key: %s", key.Type())
+	}
+
+	hashKey := hashable.HashKey()
+	return &reference{
+		load: func() (object.Object, *object.Error) {
+			if pair, ok := hash.Pairs[hashKey]; ok {
+				return pair.Value, nil
+			}
+			return nil, newError("key not found: %s", key.Inspect())
+		},
+		store: func(value object.Object) *object.Error {
+			hash.Set(hashKey, object.HashPair{Key: key, Value: value})
+			return nil
+		},
+	}, nil
+}
+
+// Spread arrays are expanded in place
 func evalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, expression := range expressions {
+		if spread, ok := expression.(*ast.SpreadExpression); ok {
+			eval := Eval(spread.Value, env)
+			if isInterruption(eval) {
+				return []object.Object{eval}
+			}
+
+			array, ok := eval.(*object.Array)
+			if !ok {
+				return []object.Object{newError("spread operand must be ARRAY, got %s", eval.Type())}
+			}
+			result = append(result, array.Elements...)
+			continue
+		}
+
 		eval := Eval(expression, env)
-		if isError(eval) {
+		if isInterruption(eval) {
 			return []object.Object{eval}
 		}
 		result = append(result, eval)
@@ -279,7 +824,12 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrObject := array.(*object.Array)
-	indexValue := index.(*object.Integer).Value
+	integer, ok := index.(*object.Integer)
+	if !ok {
+		// Big integers can't be valid indexes
+		return NULL
+	}
+	indexValue := integer.Value
 	if indexValue < 0 || indexValue > int64(len(arrObject.Elements))-1 {
 		// Invalid index
 		return NULL
@@ -303,24 +853,96 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return kvPair.Value
 }
 
-func applyFunction(functionObj object.Object, parameters []object.Object) object.Object {
+// The call stack of an error is built while it propagates: each call it goes through adds its frame to the trace
+func applyFunction(functionObj object.Object, parameters []object.Object, callSite token.Position) object.Object {
+	var result object.Object
+	var frame object.Frame
 	switch function := functionObj.(type) {
 	case *object.Function:
-		functionEnvironment := extendFunctionEnv(function, parameters)
-		eval := Eval(function.Body, functionEnvironment)
-		return unwrapReturnValue(eval)
+		required := len(function.Parameters)
+		for i, defaultValue := range function.Defaults {
+			if defaultValue != nil {
+				required = i
+				break
+			}
+		}
+		if errObj := checkArity(function.Name, required, len(function.Parameters), function.Rest != nil, len(parameters)); errObj != nil {
+			return errObj
+		}
+		if callDepth >= maxCallDepth {
+			return newError("maximum call depth exceeded: %d", maxCallDepth)
+		}
+
+		// Eval recovers from panics, the depth is always restored
+		callDepth++
+		functionEnvironment, errObj := extendFunctionEnv(function, parameters)
+		if errObj == nil {
+			result = unwrapReturnValue(Eval(function.Body, functionEnvironment))
+		} else {
+			result = errObj
+		}
+		callDepth--
+		frame = object.Frame{Function: function.Name, CallSite: callSite}
 	case *object.Builtin:
-		return function.Fn(parameters...)
+		if errObj := checkArity(function.Name, len(function.Parameters), len(function.Parameters), function.Variadic, len(parameters)); errObj != nil {
+			return errObj
+		}
+		result = function.Fn(parameters...)
+		frame = object.Frame{Function: function.Name, CallSite: callSite}
 	default:
 		return newError("not a function: %s", function.Type())
 	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		errObj.Trace = append(errObj.Trace, frame)
+	}
+	return result
+}
+
+// Report a call with a number of arguments the function doesn't accept, variadic functions accept any number of
+// arguments beyond max
+func checkArity(name string, min, max int, variadic bool, got int) *object.Error {
+	if got >= min && (got <= max || variadic) {
+		return nil
+	}
+
+	if name == "" {
+		name = "anonymous function"
+	}
+	switch {
+	case variadic:
+		return newError("wrong number of arguments to %s: expected at least %d, got %d", name, min, got)
+	case min != max:
+		return newError("wrong number of arguments to %s: expected %d to %d, got %d", name, min, max, got)
+	default:
+		return newError("wrong number of arguments to %s: expected %d, got %d", name, min, got)
+	}
+}
+
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	sb := strings.Builder{}
+	for _, part := range node.Parts {
+		value := Eval(part, env)
+		if isInterruption(value) {
+			return value
+		}
+		sb.WriteString(value.Inspect())
+	}
+	return &object.String{Value: sb.String()}
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := map[object.HashKey]object.HashPair{}
+	hash := object.NewHash()
 	for _, nodesPair := range node.Pairs {
+		if spread, ok := nodesPair.Key.(*ast.SpreadExpression); ok {
+			if errObj := spreadHash(hash, spread, env); errObj != nil {
+				return errObj
+			}
+			continue
+		}
+
 		key := Eval(nodesPair.Key, env)
-		if isError(key) {
+		if isInterruption(key) {
 			return key
 		}
 
@@ -330,22 +952,57 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		}
 
 		value := Eval(nodesPair.Value, env)
-		if isError(value) {
+		if isInterruption(value) {
 			return value
 		}
 
-		hash := hashKey.HashKey()
-		pairs[hash] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
-func extendFunctionEnv(function *object.Function, parameters []object.Object) *object.Environment {
+// Copy the pairs of the spread hash, they override the pairs already set
+func spreadHash(hash *object.Hash, spread *ast.SpreadExpression, env *object.Environment) object.Object {
+	value := Eval(spread.Value, env)
+	if isInterruption(value) {
+		return value
+	}
+
+	source, ok := value.(*object.Hash)
+	if !ok {
+		return newError("spread operand must be HASH, got %s", value.Type())
+	}
+	for _, pair := range source.OrderedPairs() {
+		hash.Set(pair.Key.(object.Hashable).HashKey(), pair)
+	}
+	return nil
+}
+
+// Bind the arguments in a new environment enclosed by the function's one. Defaults of the missing arguments are
+// evaluated in that environment, they can refer to the preceding parameters
+func extendFunctionEnv(function *object.Function, parameters []object.Object) (*object.Environment, object.Object) {
 	newEnv := object.NewEnclosedEnvironment(function.Env)
 	for i, p := range function.Parameters {
-		newEnv.Set(p.Value, parameters[i])
+		if i < len(parameters) {
+			newEnv.Set(p.Value, parameters[i])
+			continue
+		}
+
+		value := Eval(function.Defaults[i], newEnv)
+		if isError(value) {
+			return nil, value
+		}
+		newEnv.Set(p.Value, value)
+	}
+
+	if function.Rest != nil {
+		rest := []object.Object{}
+		if len(parameters) > len(function.Parameters) {
+			rest = append(rest, parameters[len(function.Parameters):]...)
+		}
+		newEnv.Set(function.Rest.Value, &object.Array{Elements: rest})
 	}
-	return newEnv
+	return newEnv, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -368,10 +1025,48 @@ func isTrue(obj object.Object) bool {
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// Convert a number object to a float, integers are promoted
+func toFloat(obj object.Object) *object.Float {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return &object.Float{Value: float64(obj.Value)}
+	case *object.BigInteger:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return &object.Float{Value: value}
+	default:
+		return obj.(*object.Float)
+	}
+}
+
+// Convert an integer object to a big integer
+func toBigInt(obj object.Object) *big.Int {
+	if integer, ok := obj.(*object.Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*object.BigInteger).Value
+}
+
 func newError(format string, values ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, values...)}
 }
 
 func isError(obj object.Object) bool {
-	return obj != nil && obj.Inspect() == object.ERROR_OBJ
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+// Results stopping the evaluation of the enclosing expressions, they are passed up unchanged: errors, and the return,
+// break and continue signals raised in an if expression used as a value
+func isInterruption(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return false
 }
@@ -1,11 +1,14 @@
 package evaluator
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/valsov/gointerpreter/ast"
 	"github.com/valsov/gointerpreter/lexer"
 	"github.com/valsov/gointerpreter/object"
 	"github.com/valsov/gointerpreter/parser"
+	"github.com/valsov/gointerpreter/token"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -29,6 +32,17 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
 		{"10 + 51 % 2", 11},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"~-1", 0},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"(1 << 64) >> 60", 16},
+		{"1 | 2 << 2 & 15", 9},
+		{"0xFF & 0b1010", 10},
+		{"0o777 + 1_000", 1511},
 	}
 
 	for _, tt := range tests {
@@ -37,6 +51,95 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 2.5", 3.5},
+		{"2.5 * 2", 5.0},
+		{"7 / 2.0", 3.5},
+		{"7.5 % 2", 1.5},
+		{"1 / 0.0 > 1e308", true},
+		{"1.5 < 2", true},
+		{"2 >= 2.0", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"let x = 1.5; x += 1; x", 2.5},
+		{"let x = 0.5; x++; x", 1.5},
+		{"{1.0: \"a\", 2: \"b\"}[1.0]", "a"},
+		{"{1.0: \"a\"}[1]", "a"},
+		{"{0.0: \"zero\"}[-0.0]", "zero"},
+		{"1.5 & 1", "unknown operator: FLOAT & FLOAT"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{"1.5 + \"a\"", "type mismatch: FLOAT + STRING"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-9223372036854775808 / -1", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"1 << 100", "1267650600228229401496703205376"},
+		{"(1 << 100) >> 98", "4"},
+		{"-(1 << 100) >> 200", "-1"},
+		{"123456789012345678901234567890", "123456789012345678901234567890"},
+		{"0x1_0000_0000_0000_0000", "18446744073709551616"},
+		{"09_223_372_036_854_775_808", "9223372036854775808"},
+		{"123456789012345678901234567890 % 1000", "890"},
+		{"~(1 << 64)", "-18446744073709551617"},
+		{"(1 << 64) & ((1 << 64) | 5)", "18446744073709551616"},
+		{"let f = fn(n) { if (n == 0) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+		{"let x = 9223372036854775807; x++; x", "9223372036854775808"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+		{"2.0 * 9223372036854775808", "1.8446744073709552e+19"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong value. expected=%s, got=%s", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// Results that fit again in an int64 go back to a plain Integer
+	testIntegerObject(t, testEval("(9223372036854775807 + 1) - 1"), 9223372036854775807)
+
+	comparisons := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"9223372036854775808 > 9223372036854775807", true},
+		{"(1 << 64) == 18446744073709551616", true},
+		{"(1 << 64) != (1 << 65)", true},
+		{"-(1 << 64) < 0", true},
+		{"{18446744073709551616: \"big\"}[1 << 64]", "big"},
+		{"{0: \"small\"}[(1 << 64) - (1 << 64)]", "small"},
+		{"[1, 2][1 << 64]", nil},
+		{"let a = [1]; a[1 << 64] = 2", "index out of range: 18446744073709551616 with length 1"},
+		{"1 << (1 << 64)", "shift count too large: 18446744073709551616"},
+		{"(1 << 64) << -1", "negative shift count: -1"},
+	}
+
+	for _, tt := range comparisons {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -52,6 +155,12 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"3 >= 2", true},
 		{"true == true", true},
 		{"false == false", true},
 		{"true == false", false},
@@ -88,6 +197,35 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"true || false && false", true},
+		{"let n = 0; false && (n = 1); n", 0},
+		{"let n = 0; true || (n = 1); n", 0},
+		{"let n = 0; true && (n = 1); n", 1},
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"true && undefined", "identifier not found: undefined"},
+		{"undefined || true", "identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -100,6 +238,39 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else if (3 > 2) { 40 } else { 50 }", 40},
+		{"let x = 3; if (x == 1) { 10 } else if (x == 2) { 20 } else if (x == 3) { 30 }", 30},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestConditionalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 10 : 20", 10},
+		{"false ? 10 : 20", 20},
+		{"1 < 2 ? 10 : 20", 10},
+		{"let x = 5; x > 3 ? x * 2 : x", 10},
+		{"false ? 1 : false ? 2 : 3", 3},
+		{"true ? false ? 1 : 2 : 3", 2},
+		{"true ? 1 : notDefined", 1},
+		{"false ? notDefined() : 2", 2},
+		{`{true ? "a" : "b": 1 > 2 ? 5 : 6}["a"]`, 6},
+		{"let max = fn(a, b) { a > b ? a : b }; max(3, 7)", 7},
 	}
 
 	for _, tt := range tests {
@@ -207,6 +378,22 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"~true",
+			"unknown operator: ~BOOLEAN",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"8 >> -2",
+			"negative shift count: -2",
+		},
+		{
+			"true & false",
+			"unknown operator: BOOLEAN & BOOLEAN",
+		},
 		{
 			`"test" - "test"`,
 			"unknown operator: STRING - STRING",
@@ -232,6 +419,195 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+// An error must stop the evaluation where it is raised: the counter c shows which side effects took place
+func TestErrorPropagation(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedCounter int64
+	}{
+		{"let f = fn(a, b, d) { c = 10 }; f(c += 1, undefined, c += 1)", "identifier not found: undefined", 1},
+		{"undefined(c += 1)", "identifier not found: undefined", 0},
+		{"let f = fn() { c += 1; undefined; c += 1 }; f() + 1", "identifier not found: undefined", 1},
+		{"let f = fn() { return -true; c += 1 }; f()", "unknown operator: -BOOLEAN", 0},
+		{"len(c += 1, 1 + true)", "type mismatch: INTEGER + BOOLEAN", 1},
+		{"[c += 1, 1 + true, c += 1]", "type mismatch: INTEGER + BOOLEAN", 1},
+		{"undefined[c += 1]", "identifier not found: undefined", 0},
+		{"[1, 2][-true]", "unknown operator: -BOOLEAN", 0},
+		{"let a = [1]; a[undefined] = (c += 1)", "identifier not found: undefined", 0},
+		{"{c += 1: 1, undefined: c += 1, 3: c += 1}", "identifier not found: undefined", 1},
+		{`{"a": undefined, "b": c += 1}`, "identifier not found: undefined", 0},
+		{`{"a": 1}[undefined]`, "identifier not found: undefined", 0},
+		{"if (undefined) { c += 1 } else { c += 2 }", "identifier not found: undefined", 0},
+		{"if (false) { 1 } else if (-true) { c += 1 } else { c += 2 }", "unknown operator: -BOOLEAN", 0},
+		{"undefined ? (c += 1) : (c += 2)", "identifier not found: undefined", 0},
+		{"!undefined", "identifier not found: undefined", 0},
+		{"-(c += 1) + undefined", "identifier not found: undefined", 1},
+		{"while (c < 3 && undefined) { c += 1 }", "identifier not found: undefined", 0},
+		{"while (c < 3) { c += 1; undefined }", "identifier not found: undefined", 1},
+		{"for (let i = undefined; i < 5; i++) { c += 1 }", "identifier not found: undefined", 0},
+		{"for (let i = 0; i < 5 - true; i++) { c += 1 }", "type mismatch: INTEGER - BOOLEAN", 0},
+		{"for (let i = 0; i < 5; i += true) { c += 1 }", "type mismatch: INTEGER + BOOLEAN", 1},
+		{"for (x in undefined) { c += 1 }", "identifier not found: undefined", 0},
+		{"for (x in [1, 2, 3]) { c += 1; x + true }", "type mismatch: INTEGER + BOOLEAN", 1},
+		{`"${c += 1} ${undefined} ${c += 1}"`, "identifier not found: undefined", 1},
+		{"let x = undefined; c += 1", "identifier not found: undefined", 0},
+		{"c += undefined", "identifier not found: undefined", 0},
+		{"c++ + undefined", "identifier not found: undefined", 1},
+		{"c = 1 / 0; c += 1", "division by zero: INTEGER / INTEGER", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q: unexpected parser errors: %v", tt.input, p.Errors())
+		}
+
+		env := object.NewEnvironment()
+		env.Set("c", &object.Integer{Value: 0})
+		evaluated := Eval(program, env)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+
+		counter, _ := env.Get("c")
+		testIntegerObject(t, counter, tt.expectedCounter)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedStart   token.Position
+		expectedEnd     token.Position
+	}{
+		{"1 / 0", "division by zero: INTEGER / INTEGER", token.Position{Line: 1, Column: 1}, token.Position{Line: 1, Column: 6}},
+		{"let x = 5;\nx % (2 - 2)", "division by zero: INTEGER % INTEGER", token.Position{Line: 2, Column: 1}, token.Position{Line: 2, Column: 11}},
+		{"(1 << 64) / 0", "division by zero: INTEGER / INTEGER", token.Position{Line: 1, Column: 2}, token.Position{Line: 1, Column: 14}},
+		{"let x = 1; x /= 0", "division by zero: INTEGER / INTEGER", token.Position{Line: 1, Column: 12}, token.Position{Line: 1, Column: 18}},
+		{"let f = fn(n) {\n  10 / n\n}; f(0)", "division by zero: INTEGER / INTEGER", token.Position{Line: 2, Column: 3}, token.Position{Line: 2, Column: 9}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Span.Start != tt.expectedStart || errObj.Span.End != tt.expectedEnd {
+			t.Errorf("%q: wrong error span. expected=%s-%s, got=%s-%s", tt.input, tt.expectedStart, tt.expectedEnd, errObj.Span.Start, errObj.Span.End)
+		}
+	}
+
+	expected := "ERROR: 1:1: division by zero: INTEGER / INTEGER"
+	if inspected := testEval("1 / 0").Inspect(); inspected != expected {
+		t.Errorf("wrong error Inspect(). expected=%q, got=%q", expected, inspected)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	// A prefix expression without operand can't be produced by the parser, evaluating it panics
+	operator := token.Token{Type: token.MINUS, Literal: "-", Span: token.Span{Start: token.Position{Line: 1, Column: 3}, End: token.Position{Line: 1, Column: 4}}}
+	node := &ast.PrefixExpression{Token: operator, Operator: "-"}
+
+	evaluated := Eval(node, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "internal error: runtime error: invalid memory address or nil pointer dereference" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if errObj.Span.Start != operator.Span.Start {
+		t.Errorf("wrong error position. expected=%s, got=%s", operator.Span.Start, errObj.Span.Start)
+	}
+}
+
+func TestMaximumCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(n) { f(n + 1) }; f(0)", "maximum call depth exceeded: 10000"},
+		{"let even = fn(n) { odd(n + 1) }; let odd = fn(n) { even(n + 1) }; even(0)", "maximum call depth exceeded: 10000"},
+		{"let f = fn(n, d = f(n)) { 1 }; f(0)", "maximum call depth exceeded: 10000"},
+		{"let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } }; sum(5000)", 12502500},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+		if callDepth != 0 {
+			t.Fatalf("%q: call depth not restored. got=%d", tt.input, callDepth)
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	input := `let inner = fn(x) { x + undefined };
+let outer = fn(x) {
+	let result = inner(x);
+	result
+};
+let alias = outer;
+fn() { alias(1) }()`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expectedTrace := []object.Frame{
+		{Function: "inner", CallSite: token.Position{Line: 3, Column: 15}},
+		{Function: "outer", CallSite: token.Position{Line: 7, Column: 8}},
+		{Function: "", CallSite: token.Position{Line: 7, Column: 1}},
+	}
+	if !reflect.DeepEqual(errObj.Trace, expectedTrace) {
+		t.Fatalf("wrong trace. expected=%v, got=%v", expectedTrace, errObj.Trace)
+	}
+
+	expectedInspect := `ERROR: 1:25: identifier not found: undefined
+	in inner called at 3:15
+	in outer called at 7:8
+	in anonymous function called at 7:1`
+	if errObj.Inspect() != expectedInspect {
+		t.Errorf("wrong inspect. expected=%q, got=%q", expectedInspect, errObj.Inspect())
+	}
+
+	evaluated = testEval(`let f = fn() { len(1) }; f()`)
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expectedTrace = []object.Frame{
+		{Function: "len", CallSite: token.Position{Line: 1, Column: 16}},
+		{Function: "f", CallSite: token.Position{Line: 1, Column: 26}},
+	}
+	if !reflect.DeepEqual(errObj.Trace, expectedTrace) {
+		t.Errorf("wrong trace. expected=%v, got=%v", expectedTrace, errObj.Trace)
+	}
+
+	evaluated = testEval("-true")
+	if errObj, ok := evaluated.(*object.Error); !ok || len(errObj.Trace) != 0 {
+		t.Errorf("expected an error without trace. got=%+v", evaluated)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -248,6 +624,198 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestCompoundAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 5; a += 3; a;", 8},
+		{"let a = 5; a -= 3; a;", 2},
+		{"let a = 5; a *= 3; a;", 15},
+		{"let a = 15; a /= 3; a;", 5},
+		{"let a = 15; a %= 4; a;", 3},
+		{"let a = 5; a += 3", 8},
+		{"let a = 1; let b = 2; a += b += 3; a * 10 + b", 65},
+		{"let x = 1; let inc = fn() { x += 1; }; inc(); inc(); x", 3},
+		{"let x = 10; let f = fn(x) { x += 1; x }; f(1) + x", 12},
+		{"let x = 1; let f = fn() { let g = fn() { x *= 7 }; g() }; f(); x", 7},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"y += 1", "identifier not found: y"},
+		{`let s = "a"; s -= "b"`, "unknown operator: STRING - STRING"},
+		{"let a = 1; a += true", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 5; a = 3; a;", 3},
+		{"let a = 5; a = 3", 3},
+		{"let a = 1; let b = 2; a = b = 7; a + b", 14},
+		{"let x = 1; let set = fn(v) { x = v }; set(42); x", 42},
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; f() * 10 + x", 31},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1; c } }; let next = counter(); next(); next(); next()", 3},
+		{"let arr = [1, 2, 3]; arr[0] = 10; arr[0] + arr[1]", 12},
+		{"let arr = [1, 2, 3]; arr[2] += 5; arr[2]", 8},
+		{"let arr = [1, 2, 3]; arr[1]++; arr[1]", 3},
+		{"let arr = [1, 2, 3]; let other = arr; other[0] = 7; arr[0]", 7},
+		{"let m = [[1, 2], [3, 4]]; m[1][0] = 9; m[1][0]", 9},
+		{"let i = 0; let arr = [1, 2]; arr[i++] = 5; arr[0] * 10 + i", 51},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"]`, 2},
+		{`let h = {}; h["new"] = 3; h["new"]`, 3},
+		{`let h = {"a": 1}; h["a"] *= 4; h["a"]`, 4},
+		{`let h = {1: 1}; h[true] = 2; h[1] + h[true]`, 3},
+		{`let h = {"n": 1}; let inc = fn() { h["n"]++ }; inc(); inc(); h["n"]`, 3},
+		{"y = 1", "assignment to undeclared identifier: y"},
+		{"let f = fn() { z = 1 }; f()", "assignment to undeclared identifier: z"},
+		{"let arr = [1]; arr[1] = 2", "index out of range: 1 with length 1"},
+		{"let arr = [1]; arr[-1] = 2", "index out of range: -1 with length 1"},
+		{`let arr = [1]; arr["a"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let h = {}; h[fn(x) { x }] = 1`, "unusable as hash key: FUNCTION"},
+		{`let h = {}; h["a"] += 1`, "key not found: a"},
+		{`let s = "abc"; s[0] = "b"`, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x++; x", 2},
+		{"let x = 1; x--; x", 0},
+		{"let x = 1; ++x; x", 2},
+		{"let x = 1; --x; x", 0},
+		{"let x = 1; let y = x++; y * 10 + x", 12},
+		{"let x = 1; let y = ++x; y * 10 + x", 22},
+		{"let x = 5; let y = x--; y * 10 + x", 54},
+		{"let x = 5; let y = --x; y * 10 + x", 44},
+		{"let x = 1; -x++", -1},
+		{"let n = 0; let count = fn() { n++ }; count(); count(); count(); n", 3},
+		{"z++", "identifier not found: z"},
+		{`let s = "a"; s++`, "unknown operator: STRING++"},
+		{"let b = true; --b", "unknown operator: --BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i++ }; i", 10},
+		{"let i = 0; while (false) { i++ }; i", 0},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (true) { i++; if (i == 7) { break; } }; i", 7},
+		{"let i = 0; let sum = 0; while (i < 10) { i++; if (i % 2 == 0) { continue; } sum += i; }; sum", 25},
+		{"let f = fn() { let i = 0; while (true) { i++; if (i > 3) { return i * 10; } } }; f()", 40},
+		{"let i = 0; let n = 0; while (i < 3) { i++; let j = 0; while (true) { j++; if (j == 2) { break } n++ } }; n", 3},
+		{"let i = 0; while (i < 100000) { i += 1 }; i", 100000},
+		{"let i = 0; while (i < 3) { i++; true + 1; }", "type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+// Signals raised in an if expression used as a value stop the enclosing expression instead of being used as a value
+func TestSignalsInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let n = 0; while (n < 10) { n++; let a = if (n > 3) { break; }; }; n", 4},
+		{"let n = 0; let m = 0; while (n < 5) { n++; m = if (n % 2 == 0) { continue; } else { m + 1 }; }; m", 3},
+		{"let n = 0; let m = 0; while (n < 5) { n++; m += if (n > 2) { break; } else { 1 }; }; m", 2},
+		{"let n = 0; for (x in [1, 2, 3]) { n = n + if (x == 2) { continue; } else { x }; }; n", 4},
+		{"let s = 0; while (true) { s = [1, if (s > 0) { break; } else { 2 }][1]; }; s", 2},
+		{"let f = fn() { let a = if (true) { return 5; }; 10 }; f()", 5},
+		{"let f = fn() { 1 + if (true) { return 5; } }; f()", 5},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (let i = 1; i < 5; i++) { sum += i }; sum", 10},
+		{"for (let i = 0; i < 3; i++) { 1 }", nil},
+		{"let i = 0; for (i = 5; i < 8; i++) {}; i", 8},
+		{"let n = 0; for (;;) { n++; if (n == 5) { break } }; n", 5},
+		{"let n = 0; for (; n < 4;) { n += 2 }; n", 4},
+		{"let sum = 0; for (let i = 0; i < 10; i++) { if (i % 3 != 0) { continue } sum += i }; sum", 18},
+		{"let i = 42; for (let i = 0; i < 3; i++) {}; i", 42},
+		{"for (let i = 0; i < 3; i++) {}; i", "identifier not found: i"},
+		{"let f = fn(arr) { for (let i = 0; i < len(arr); i++) { if (arr[i] > 2) { return i } } -1 }; f([1, 2, 3, 4])", 2},
+		{"let total = 0; for (let i = 0; i < 3; i++) { for (let j = 0; j < 3; j++) { if (j == 1) { break } total++ } }; total", 3},
+		{"let arr = [1, 2, 3]; for (let i = 0; i < len(arr); i++) { arr[i] *= 2 }; arr[0] + arr[1] + arr[2]", 12},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"let sum = 0; for (i, x in [5, 6, 7]) { sum += i * x }; sum", 20},
+		{"for (x in []) { x }", nil},
+		{"let keys = \"\"; for (k in {\"b\": 1, \"a\": 2, \"c\": 3}) { keys += k }; keys", "bac"},
+		{"let h = {\"a\": \"1\", \"b\": \"2\"}; h[\"a\"] = \"5\"; h[\"z\"] = \"0\"; let s = \"\"; for (k, v in h) { s += k + v }; s", "a5b2z0"},
+		{"let s = \"\"; for (ch in \"héllo\") { s = ch + s }; s", "olléh"},
+		{"let n = 0; for (i, ch in \"abc\") { n += i }; n", 3},
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break } n += x }; n", 3},
+		{"let n = 0; for (x in [1, 2, 3, 4]) { if (x % 2 == 0) { continue } n += x }; n", 4},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } } }; f()", 20},
+		{"let fns = []; for (x in [1, 2, 3]) { fns = push(fns, fn() { x }) }; fns[0]() + fns[2]()", 4},
+		{"let x = 42; for (x in [1, 2]) {}; x", 42},
+		{"for (x in 5) {}", "cannot iterate over INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	// "café" is written with a precomposed é first, then with an e followed by a combining accent
+	input := "let caf\u00e9 = 1; let 数 = 2; caf\u0065\u0301 + 数"
+
+	l := lexer.New(input)
+	l.SetMode(lexer.NormalizeIdentifiers)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors: %v", p.Errors())
+	}
+
+	testIntegerObject(t, Eval(program, object.NewEnvironment()), 3)
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -273,6 +841,78 @@ func TestFunctionObject(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b = 10) { a + b }; f(1)", 11},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2)", 3},
+		{"let f = fn(a, b = a * 2) { a + b }; f(3)", 9},
+		{"let n = 1; let f = fn(a = n) { a }; n = 5; f()", 5},
+		{"let f = fn(a = undefined) { a }; f(1)", 1},
+		{"let f = fn(a = undefined) { a }; f()", "identifier not found: undefined"},
+		{"let f = fn(a, ...rest) { len(rest) }; f(1)", 0},
+		{"let f = fn(a, ...rest) { len(rest) }; f(1, 2, 3)", 2},
+		{"let f = fn(...rest) { rest[1] }; f(1, 2, 3)", 2},
+		{"let f = fn(a, b = 2, ...rest) { a + b + len(rest) }; f(1, 5, 0, 0)", 8},
+		{"let f = fn(a, b = 10) { a + b }; f()", "wrong number of arguments to f: expected 1 to 2, got 0"},
+		{"let f = fn(a, b = 10) { a + b }; f(1, 2, 3)", "wrong number of arguments to f: expected 1 to 2, got 3"},
+		{"let f = fn(a, ...rest) { a }; f()", "wrong number of arguments to f: expected at least 1, got 0"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("fn(a, b = [1, 2], ...rest) { a }")
+	expected := "fn(a, b = [1, 2], ...rest) {\na\n}"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong inspect. expected=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestSpreadOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b, c) { a + b + c }; let args = [1, 2, 3]; add(...args)", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)", 6},
+		{"let f = fn(...rest) { len(rest) }; f(...[], ...[1, 2], 3)", 3},
+		{"let add = fn(a, b) { a + b }; add(...[1, 2, 3])", "wrong number of arguments to add: expected 2, got 3"},
+		{"len(...[[1, 2]])", 2},
+		{"len(...1)", "spread operand must be ARRAY, got INTEGER"},
+		{`len(...{"a": 1})`, "spread operand must be ARRAY, got HASH"},
+		{"let xs = [2, 3]; len([1, ...xs, 4])", 4},
+		{"let xs = [2, 3]; [1, ...xs, 4][3]", 4},
+		{"[...undefined]", "identifier not found: undefined"},
+		{`[..."ab"]`, "spread operand must be ARRAY, got STRING"},
+		{`let h = {"a": 1, "b": 2}; {...h, "b": 3}["b"]`, 3},
+		{`let h = {"a": 1, "b": 2}; {"b": 3, ...h}["b"]`, 2},
+		{`let h = {"a": 1}; {...h, ...{"c": 5}}["c"]`, 5},
+		{`{...[1]}`, "spread operand must be HASH, got ARRAY"},
+		{`{...undefined}`, "identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+
+	inspectTests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {"a": 1, "b": 2}; {"c": 0, ...h, "a": 3}`, `{c: 0, a: 3, b: 2}`},
+		{`let xs = [1, 2]; let ys = [...xs]; ys[0] = 9; [xs, ys]`, `[[1, 2], [9, 2]]`},
+	}
+	for _, tt := range inspectTests {
+		if evaluated := testEval(tt.input); evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -291,6 +931,24 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestFunctionArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b) { a + b }; add(1)", "wrong number of arguments to add: expected 2, got 1"},
+		{"let add = fn(a, b) { a + b }; add(1, 2, 3)", "wrong number of arguments to add: expected 2, got 3"},
+		{"let add = fn(a, b) { a + b }; add(1, 2)", 3},
+		{"let f = fn() { 1 }; f(1)", "wrong number of arguments to f: expected 0, got 1"},
+		{"fn(x) { x }()", "wrong number of arguments to anonymous function: expected 1, got 0"},
+		{"let c = 0; let f = fn(x) { c = 1 }; f(); c", "wrong number of arguments to f: expected 1, got 0"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -319,6 +977,28 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = 2; let b = 3; "total: ${a + b}"`, "total: 5"},
+		{`"${1}${true}${"s"}"`, "1trues"},
+		{`let h = {"k": [1, 2]}; "v=${h["k"]} n=${if (false) { 1 }}"`, "v=[1, 2] n=null"},
+		{`let name = "x"; "outer ${"inner ${name}"}"`, "outer inner x"},
+		{`"1.5 * 2 = ${1.5 * 2}"`, "1.5 * 2 = 3.0"},
+		{`"price: \${5}"`, "price: ${5}"},
+		{"`raw ${1 + 1}`", "raw ${1 + 1}"},
+		{"let query = `SELECT *\nFROM t`; query + \";\"", "SELECT *\nFROM t;"},
+		{`"\u{1F600} \x41"`, "😀 A"},
+		{`"${undefined}"`, "identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -328,7 +1008,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
-		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len("one", "two")`, "wrong number of arguments to len: expected 1, got 2"},
+		{`len()`, "wrong number of arguments to len: expected 1, got 0"},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
 		{`first([1, 2, 3])`, 1},
@@ -341,6 +1022,9 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`push([])`, "wrong number of arguments to push: expected 2, got 1"},
+		{`first([1], [2])`, "wrong number of arguments to first: expected 1, got 2"},
+		{`print()`, nil},
 	}
 
 	for _, tt := range tests {
@@ -534,6 +1218,26 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{-0.0: 5}[0]`,
+			5,
+		},
+		{
+			`{1e20: 5}[100000000000000000000]`,
+			5,
+		},
+		{
+			`{1: 5}[1.5]`,
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -555,6 +1259,42 @@ func testEval(input string) object.Object {
 	return Eval(program, environment)
 }
 
+// Check an evaluation result: an int is an Integer, a string is an error message, nil is NULL
+func testExpectedObject(t *testing.T, input string, obj object.Object, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case float64:
+		return testFloatObject(t, obj, expected)
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case nil:
+		return testNullObject(t, obj)
+	case string:
+		if str, ok := obj.(*object.String); ok {
+			if str.Value != expected {
+				t.Errorf("%q: String has wrong value. got=%q, expected=%q", input, str.Value, expected)
+				return false
+			}
+			return true
+		}
+
+		errObj, ok := obj.(*object.Error)
+		if !ok {
+			t.Errorf("%q: object is not Error. got=%T (%+v)", input, obj, obj)
+			return false
+		}
+		if errObj.Message != expected {
+			t.Errorf("%q: wrong error message. expected=%q, got=%q", input, expected, errObj.Message)
+			return false
+		}
+		return true
+	default:
+		t.Errorf("%q: type of expected value not handled. got=%T", input, expected)
+		return false
+	}
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -569,6 +1309,20 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, expected=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
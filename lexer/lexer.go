@@ -1,29 +1,86 @@
 package lexer
 
 import (
+	"bufio"
 	"errors"
+	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/valsov/gointerpreter/token"
+	"golang.org/x/text/unicode/norm"
 )
 
+// Chars are read from a buffered reader, only the token being read is kept in memory
 type Lexer struct {
-	input        []rune
-	position     int  // Position in input pointing to current char (ch)
-	readPosition int  // Reading position in input (peeker)
-	ch           rune // Current char
+	reader      *bufio.Reader
+	err         error
+	ch          rune // Current char
+	atEnd       bool // Set once ch is past the end of the input
+	next        rune // Char following ch (peeker)
+	nextAtEnd   bool
+	lexeme      strings.Builder // Chars of the token being read, up to ch excluded
+	filename    string
+	mode        Mode
+	braceDepths []int // Braces opened in each enclosing string interpolation, the last one is the innermost
+	line        int   // Source line of the current char
+	column      int   // Source column of the current char, counted in runes
 }
 
+// Options changing the tokens produced by the lexer
+type Mode uint
+
+const (
+	ScanComments         Mode = 1 << iota // Emit COMMENT tokens instead of skipping comments
+	NormalizeIdentifiers                  // Convert identifiers to Unicode NFC, so visually identical names are equal
+)
+
 func New(input string) *Lexer {
-	lexer := &Lexer{input: []rune(input)}
+	return NewReader(strings.NewReader(input))
+}
+
+// Create a lexer reading its input incrementally, through a buffer of bounded size
+func NewReader(reader io.Reader) *Lexer {
+	lexer := &Lexer{reader: bufio.NewReader(reader), line: 1}
+	lexer.next, lexer.nextAtEnd = lexer.readRune()
 	lexer.readChar()
 	return lexer
 }
 
+// Error that stopped the reading of the input before its end, if any. The input is then considered to end there
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Set the file name reported in the positions of the produced tokens
+func (l *Lexer) SetFilename(filename string) {
+	l.filename = filename
+}
+
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhiteSpaces()
+
+		start := l.currentPosition()
+		l.lexeme.Reset()
+		tok := l.readToken()
+		tok.Span = token.Span{Start: start, End: l.currentPosition()}
+
+		if tok.Type != token.COMMENT || l.mode&ScanComments != 0 {
+			return tok
+		}
+	}
+}
 
-	l.skipWhiteSpaces()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -35,7 +92,14 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		switch l.peekChar() {
+		case '+':
+			tok = l.readTwoCharToken(token.INCREMENT)
+		case '=':
+			tok = l.readTwoCharToken(token.PLUS_ASSIGN)
+		default:
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			tok.Type = token.NOT_EQ
@@ -45,25 +109,96 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		switch l.peekChar() {
+		case '-':
+			tok = l.readTwoCharToken(token.DECREMENT)
+		case '=':
+			tok = l.readTwoCharToken(token.MINUS_ASSIGN)
+		default:
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		switch l.peekChar() {
+		case '/':
+			tok.Type = token.COMMENT
+			tok.Literal = l.readLineComment()
+			return tok // The comment reading already advanced past its end
+		case '*':
+			tok.Literal, tok.Type = l.readBlockComment()
+			return tok
+		case '=':
+			tok = l.readTwoCharToken(token.SLASH_ASSIGN)
+		default:
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '%':
-		tok = newToken(token.MODULO, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(token.MODULO_ASSIGN)
+		} else {
+			tok = newToken(token.MODULO, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(token.AND)
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(token.OR)
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.readTwoCharToken(token.SHIFT_LEFT)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.readTwoCharToken(token.SHIFT_RIGHT)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.braceDepths); n > 0 {
+			l.braceDepths[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		n := len(l.braceDepths)
+		switch {
+		case n > 0 && l.braceDepths[n-1] == 0:
+			// End of an interpolation, resume reading the string
+			l.braceDepths = l.braceDepths[:n-1]
+			tok = l.readStringToken(token.TEMPLATE_TAIL, token.TEMPLATE_MIDDLE)
+		case n > 0:
+			l.braceDepths[n-1]--
+			tok = newToken(token.RBRACE, l.ch)
+		default:
+			tok = newToken(token.RBRACE, l.ch)
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -76,11 +211,29 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COLON, l.ch)
 	case '?':
 		tok = newToken(token.QMARK, l.ch)
+	case '.':
+		switch {
+		case l.peekChar() != '.':
+			tok.Type = token.ILLEGAL
+			tok.Literal = fmt.Sprintf("unexpected character %q", l.ch)
+		default:
+			l.readChar()
+			if l.peekChar() == '.' {
+				l.readChar()
+				tok.Type = token.ELLIPSIS
+				tok.Literal = "..."
+			} else {
+				tok.Type = token.ILLEGAL
+				tok.Literal = `unexpected "..", expected "..."`
+			}
+		}
 	case 0:
 		tok.Type = token.EOF
 		tok.Literal = ""
 	case '"':
-		str, err := l.readString()
+		tok = l.readStringToken(token.STRING, token.TEMPLATE_HEAD)
+	case '`':
+		str, err := l.readRawString()
 		if err != nil {
 			tok.Type = token.ILLEGAL
 			tok.Literal = err.Error()
@@ -89,14 +242,16 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = str
 		}
 	default:
-		if isLetter(l.ch) || isDigit(l.ch) {
-			literal, tokenType := l.readWhileValid()
-			tok.Literal = literal
-			tok.Type = tokenType
-			// readWhileValid() already advanced read pointers, no need to call readChar() -> return early
+		if isDigit(l.ch) {
+			tok.Literal, tok.Type = l.readNumber()
+			// readNumber() already advanced read pointers, no need to call readChar() -> return early
+			return tok
+		} else if isIdentifierStart(l.ch) {
+			tok.Literal, tok.Type = l.readIdentifier()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok.Type = token.ILLEGAL
+			tok.Literal = fmt.Sprintf("unexpected character %q", l.ch)
 		}
 	}
 
@@ -106,20 +261,42 @@ func (l *Lexer) NextToken() token.Token {
 
 // Read next char from the input, loading it in the lexer and avdancing the read pointers
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	if l.atEnd {
+		return // Already past the end of input, keep the EOF position stable
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.column++
+	}
+
+	l.lexeme.WriteRune(l.ch)
+	l.ch, l.atEnd = l.next, l.nextAtEnd
+	if !l.atEnd {
+		l.next, l.nextAtEnd = l.readRune()
 	}
-	l.position = l.readPosition
-	l.readPosition++
 }
 
-func (l *Lexer) peekChar() rune {
-	if l.readPosition >= len(l.input) {
-		return 0
+// Read a rune from the input, the returned rune is 0 at the end of the input
+func (l *Lexer) readRune() (rune, bool) {
+	ch, _, err := l.reader.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			l.err = err
+		}
+		return 0, true
 	}
-	return l.input[l.readPosition]
+	return ch, false
+}
+
+func (l *Lexer) peekChar() rune {
+	return l.next
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column}
 }
 
 func (l *Lexer) skipWhiteSpaces() {
@@ -128,72 +305,301 @@ func (l *Lexer) skipWhiteSpaces() {
 	}
 }
 
-func (l *Lexer) readWhileValid() (string, token.TokenType) {
-	digitsOnly := true
-	startPosition := l.position
-	for {
-		if isLetter(l.ch) {
-			digitsOnly = false
-		} else if !isDigit(l.ch) {
-			// End of valid runes
-			break
+// Read a number literal: digits with an optional fraction and exponent, or an integer with a 0x, 0o or 0b base prefix.
+// Digits followed by letters form an identifier, except for 'e' or 'E' which always starts an exponent
+func (l *Lexer) readNumber() (string, token.TokenType) {
+	if l.ch == '0' {
+		if base, found := basePrefixes[unicode.ToLower(l.peekChar())]; found {
+			return l.readPrefixedInteger(base)
 		}
+	}
 
+	var tokenType token.TokenType = token.INT
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		if !isDigit(l.ch) {
+			return fmt.Sprintf("missing exponent digits in %q", l.lexeme.String()), token.ILLEGAL
+		}
+		l.readDigits()
 	}
 
-	literal := string(l.input[startPosition:l.position]) // l.position is used instead of l.readPosition because we are already pointing to the next (invalid) char
+	if tokenType == token.INT && isIdentifierStart(l.ch) {
+		return l.readIdentifier()
+	}
 
-	var tokenType token.TokenType
-	if digitsOnly {
-		tokenType = token.INT
-	} else {
-		tokenType = token.Lookup(literal)
+	literal := l.lexeme.String()
+	if !validSeparators(literal, isDigit) {
+		return fmt.Sprintf("'_' must separate successive digits in %q", literal), token.ILLEGAL
 	}
 	return literal, tokenType
 }
 
-func (l *Lexer) readString() (string, error) {
+// Read digits and '_' separators
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+type numberBase struct {
+	name    string
+	isDigit func(rune) bool
+}
+
+var basePrefixes = map[rune]numberBase{
+	'x': {"hexadecimal", isHexDigit},
+	'o': {"octal", func(ch rune) bool { return '0' <= ch && ch <= '7' }},
+	'b': {"binary", func(ch rune) bool { return ch == '0' || ch == '1' }},
+}
+
+func (l *Lexer) readPrefixedInteger(base numberBase) (string, token.TokenType) {
+	l.readChar() // Skip the 0, current char becomes the base letter
+	l.readChar()
+
+	for base.isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+
+	if isIdentifierPart(l.ch) {
+		// Skip the rest of the literal to resume lexing after it
+		invalid := l.ch
+		for isIdentifierPart(l.ch) {
+			l.readChar()
+		}
+		return fmt.Sprintf("invalid digit %q in %s literal", invalid, base.name), token.ILLEGAL
+	}
+
+	literal := l.lexeme.String()
+	if strings.Trim(literal[2:], "_") == "" {
+		return fmt.Sprintf("%s literal %q has no digits", base.name, literal), token.ILLEGAL
+	}
+	if !validSeparators(literal, base.isDigit) {
+		return fmt.Sprintf("'_' must separate successive digits in %q", literal), token.ILLEGAL
+	}
+	return literal, token.INT
+}
+
+// Check that every '_' of a number literal is surrounded by digits
+func validSeparators(literal string, isDigit func(rune) bool) bool {
+	runes := []rune(literal)
+	for i, ch := range runes {
+		if ch == '_' && (i == 0 || i == len(runes)-1 || !isDigit(runes[i-1]) || !isDigit(runes[i+1])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Read an identifier or a keyword, the chars already read for the current token are part of it
+func (l *Lexer) readIdentifier() (string, token.TokenType) {
+	for isIdentifierPart(l.ch) {
+		l.readChar()
+	}
+
+	literal := l.lexeme.String() // The current char isn't part of the lexeme, it's the next (invalid) char
+	if l.mode&NormalizeIdentifiers != 0 {
+		literal = norm.NFC.String(literal)
+	}
+	return literal, token.Lookup(literal)
+}
+
+// Read a comment up to the end of the line, the newline isn't part of the comment
+func (l *Lexer) readLineComment() string {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return l.lexeme.String()
+}
+
+func (l *Lexer) readBlockComment() (string, token.TokenType) {
+	l.readChar() // Skip the opening "/*"
+	l.readChar()
+	for {
+		switch {
+		case l.ch == 0:
+			return "unterminated block comment", token.ILLEGAL
+		case l.ch == '*' && l.peekChar() == '/':
+			l.readChar()
+			l.readChar()
+			return l.lexeme.String(), token.COMMENT
+		default:
+			l.readChar()
+		}
+	}
+}
+
+// Read a string segment, its type depends on whether it ends with the closing quote or with an interpolation
+func (l *Lexer) readStringToken(closedType, interpolationType token.TokenType) token.Token {
+	str, interpolation, err := l.readString()
+	if interpolation {
+		// Track the interpolation even on error, so its closing brace resumes the string
+		l.braceDepths = append(l.braceDepths, 0)
+	}
+
+	switch {
+	case err != nil:
+		return token.Token{Type: token.ILLEGAL, Literal: err.Error()}
+	case interpolation:
+		return token.Token{Type: interpolationType, Literal: str}
+	default:
+		return token.Token{Type: closedType, Literal: str}
+	}
+}
+
+// Read chars up to the closing quote or up to the "${" starting an interpolation, the current char is left on the
+// last char read. An invalid escape sequence is reported once the end of the segment is reached
+func (l *Lexer) readString() (string, bool, error) {
 	sb := strings.Builder{}
+	var escapeErr error
 	for {
 		l.readChar()
 
 		switch l.ch {
 		case 0:
-			return "", errors.New("encountered EOF before string end")
+			return "", false, errors.New("encountered EOF before string end")
+		case '$':
+			if l.peekChar() == '{' {
+				l.readChar()
+				return sb.String(), true, escapeErr
+			}
+			sb.WriteRune(l.ch)
 		case '\\':
-			l.readChar()
-			switch l.ch {
-			case '\\':
-				sb.WriteByte('\\')
-			case '"':
-				sb.WriteByte('"')
-			case 't':
-				sb.WriteByte('\t')
-			case 'n':
-				sb.WriteByte('\n')
-			case 'r':
-				sb.WriteByte('\r')
-			default:
-				sb.WriteByte('\\')
-				sb.WriteRune(l.ch)
+			if err := l.readEscape(&sb); err != nil && escapeErr == nil {
+				escapeErr = err
 			}
 		case '"':
-			return sb.String(), nil
+			return sb.String(), false, escapeErr
 		default:
 			sb.WriteRune(l.ch)
 		}
 	}
 }
 
-func isLetter(ch rune) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// Decode the escape sequence following a backslash, the current char is left on the last char of the sequence
+func (l *Lexer) readEscape(sb *strings.Builder) error {
+	l.readChar()
+	switch l.ch {
+	case '\\', '"', '$':
+		sb.WriteRune(l.ch)
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'r':
+		sb.WriteByte('\r')
+	case '0':
+		sb.WriteByte(0)
+	case 'x':
+		var value rune
+		for i := 0; i < 2; i++ {
+			if !isHexDigit(l.peekChar()) {
+				return errors.New(`\x escape must be followed by 2 hexadecimal digits`)
+			}
+			l.readChar()
+			value = value*16 + hexValue(l.ch)
+		}
+		sb.WriteRune(value)
+	case 'u':
+		if l.peekChar() != '{' {
+			return errors.New(`\u escape must be followed by a code point between braces: \u{1F600}`)
+		}
+		l.readChar()
+
+		digits := strings.Builder{}
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+			digits.WriteRune(l.ch)
+		}
+		if l.peekChar() != '}' {
+			return errors.New(`unterminated \u{...} escape`)
+		}
+		l.readChar()
+
+		value, err := strconv.ParseUint(digits.String(), 16, 32)
+		if err != nil || digits.Len() > 6 || !utf8.ValidRune(rune(value)) {
+			return fmt.Errorf(`invalid code point in \u{%s} escape`, digits.String())
+		}
+		sb.WriteRune(rune(value))
+	case 0:
+		// EOF, reported by the caller
+	default:
+		return fmt.Errorf(`invalid escape sequence \%c`, l.ch)
+	}
+	return nil
+}
+
+// Read a string between backticks, its content is kept as is and may span multiple lines
+func (l *Lexer) readRawString() (string, error) {
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case 0:
+			return "", errors.New("encountered EOF before raw string end")
+		case '`':
+			return strings.TrimPrefix(l.lexeme.String(), "`"), nil
+		}
+	}
+}
+
+// Unicode ID_Start, plus '_'
+func isIdentifierStart(ch rune) bool {
+	if ch == '_' {
+		return true
+	}
+	return unicode.In(ch, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
+}
+
+// Unicode ID_Continue, ASCII digits included
+func isIdentifierPart(ch rune) bool {
+	if isIdentifierStart(ch) {
+		return true
+	}
+	return unicode.In(ch, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+		!unicode.In(ch, unicode.Pattern_Syntax, unicode.Pattern_White_Space)
 }
 
 func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) rune {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
+// Build a token from the current and the next char, advancing the lexer to the latter
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	first := l.ch
+	l.readChar()
+	return token.Token{
+		Type:    tokenType,
+		Literal: string(first) + string(l.ch),
+	}
+}
+
 func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{
 		Type:    tokenType,
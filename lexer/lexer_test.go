@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/valsov/gointerpreter/token"
 )
@@ -16,7 +20,7 @@ func TestNewToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*%5;
+	!-/ *%5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -34,6 +38,12 @@ func TestNewToken(t *testing.T) {
 	[1, 2];
 	{"foo": "bar"}
     let lexer = "レクサー";
+	count++; --count;
+	a += 1; a -= 1; a *= 2; a /= 2; a %= 2;
+	while for break continue in
+	a && b || c;
+	<= >= & | ^ ~ << >>
+	...rest
 	`
 
 	tests := []struct {
@@ -142,6 +152,53 @@ func TestNewToken(t *testing.T) {
 		{token.ASSIGN, "="},
 		{token.STRING, "レクサー"},
 		{token.SEMICOLON, ";"},
+		{token.IDENT, "count"},
+		{token.INCREMENT, "++"},
+		{token.SEMICOLON, ";"},
+		{token.DECREMENT, "--"},
+		{token.IDENT, "count"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.MODULO_ASSIGN, "%="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IN, "in"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.BIT_AND, "&"},
+		{token.BIT_OR, "|"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
 		{token.EOF, ""},
 	}
 
@@ -159,3 +216,399 @@ func TestNewToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n\tlet y = \"éà\";\n"
+
+	tests := []struct {
+		expectedType  token.TokenType
+		expectedStart token.Position
+		expectedEnd   token.Position
+	}{
+		{token.LET, token.Position{Filename: "test.mk", Line: 1, Column: 1}, token.Position{Filename: "test.mk", Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Filename: "test.mk", Line: 1, Column: 5}, token.Position{Filename: "test.mk", Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Line: 1, Column: 7}, token.Position{Filename: "test.mk", Line: 1, Column: 8}},
+		{token.INT, token.Position{Filename: "test.mk", Line: 1, Column: 9}, token.Position{Filename: "test.mk", Line: 1, Column: 11}},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Line: 1, Column: 11}, token.Position{Filename: "test.mk", Line: 1, Column: 12}},
+		{token.LET, token.Position{Filename: "test.mk", Line: 2, Column: 2}, token.Position{Filename: "test.mk", Line: 2, Column: 5}},
+		{token.IDENT, token.Position{Filename: "test.mk", Line: 2, Column: 6}, token.Position{Filename: "test.mk", Line: 2, Column: 7}},
+		{token.ASSIGN, token.Position{Filename: "test.mk", Line: 2, Column: 8}, token.Position{Filename: "test.mk", Line: 2, Column: 9}},
+		{token.STRING, token.Position{Filename: "test.mk", Line: 2, Column: 10}, token.Position{Filename: "test.mk", Line: 2, Column: 14}},
+		{token.SEMICOLON, token.Position{Filename: "test.mk", Line: 2, Column: 14}, token.Position{Filename: "test.mk", Line: 2, Column: 15}},
+		{token.EOF, token.Position{Filename: "test.mk", Line: 3, Column: 1}, token.Position{Filename: "test.mk", Line: 3, Column: 1}},
+		{token.EOF, token.Position{Filename: "test.mk", Line: 3, Column: 1}, token.Position{Filename: "test.mk", Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+	l.SetFilename("test.mk")
+
+	for i, expected := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != expected.expectedType {
+			t.Fatalf("tests[%d] - wrong TokenType. expected=%q, got=%q", i, expected.expectedType, tok.Type)
+		}
+
+		if tok.Span.Start != expected.expectedStart {
+			t.Errorf("tests[%d] - wrong start position. expected=%s, got=%s", i, expected.expectedStart, tok.Span.Start)
+		}
+
+		if tok.Span.End != expected.expectedEnd {
+			t.Errorf("tests[%d] - wrong end position. expected=%s, got=%s", i, expected.expectedEnd, tok.Span.End)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"42", []token.Token{{Type: token.INT, Literal: "42"}}},
+		{"3.14", []token.Token{{Type: token.FLOAT, Literal: "3.14"}}},
+		{"1e5", []token.Token{{Type: token.FLOAT, Literal: "1e5"}}},
+		{"2.5E-3", []token.Token{{Type: token.FLOAT, Literal: "2.5E-3"}}},
+		{"6e+2", []token.Token{{Type: token.FLOAT, Literal: "6e+2"}}},
+		{"12abc", []token.Token{{Type: token.IDENT, Literal: "12abc"}}},
+		{"1ex", []token.Token{{Type: token.ILLEGAL, Literal: "missing exponent digits in \"1e\""}, {Type: token.IDENT, Literal: "x"}}},
+		{"1.5e", []token.Token{{Type: token.ILLEGAL, Literal: "missing exponent digits in \"1.5e\""}}},
+		{"2E;", []token.Token{{Type: token.ILLEGAL, Literal: "missing exponent digits in \"2E\""}, {Type: token.SEMICOLON, Literal: ";"}}},
+		{"1e-", []token.Token{{Type: token.ILLEGAL, Literal: "missing exponent digits in \"1e-\""}}},
+		{"1.5x", []token.Token{{Type: token.FLOAT, Literal: "1.5"}, {Type: token.IDENT, Literal: "x"}}},
+		{"5.", []token.Token{{Type: token.INT, Literal: "5"}, {Type: token.ILLEGAL, Literal: "unexpected character '.'"}}},
+		{"1e+;", []token.Token{{Type: token.ILLEGAL, Literal: "missing exponent digits in \"1e+\""}, {Type: token.SEMICOLON, Literal: ";"}}},
+		{"0x1F", []token.Token{{Type: token.INT, Literal: "0x1F"}}},
+		{"0XdeadBEEF", []token.Token{{Type: token.INT, Literal: "0XdeadBEEF"}}},
+		{"0o755", []token.Token{{Type: token.INT, Literal: "0o755"}}},
+		{"0b1010", []token.Token{{Type: token.INT, Literal: "0b1010"}}},
+		{"1_000_000", []token.Token{{Type: token.INT, Literal: "1_000_000"}}},
+		{"0b1111_0000", []token.Token{{Type: token.INT, Literal: "0b1111_0000"}}},
+		{"1_000.000_1e1_0", []token.Token{{Type: token.FLOAT, Literal: "1_000.000_1e1_0"}}},
+		{"1_abc", []token.Token{{Type: token.IDENT, Literal: "1_abc"}}},
+		{"0x", []token.Token{{Type: token.ILLEGAL, Literal: "hexadecimal literal \"0x\" has no digits"}}},
+		{"0b_", []token.Token{{Type: token.ILLEGAL, Literal: "binary literal \"0b_\" has no digits"}}},
+		{"0b102 + 1", []token.Token{{Type: token.ILLEGAL, Literal: "invalid digit '2' in binary literal"}, {Type: token.PLUS, Literal: "+"}, {Type: token.INT, Literal: "1"}}},
+		{"0o8", []token.Token{{Type: token.ILLEGAL, Literal: "invalid digit '8' in octal literal"}}},
+		{"0xFG", []token.Token{{Type: token.ILLEGAL, Literal: "invalid digit 'G' in hexadecimal literal"}}},
+		{"0x_FF", []token.Token{{Type: token.ILLEGAL, Literal: "'_' must separate successive digits in \"0x_FF\""}}},
+		{"1__000", []token.Token{{Type: token.ILLEGAL, Literal: "'_' must separate successive digits in \"1__000\""}}},
+		{"100_;", []token.Token{{Type: token.ILLEGAL, Literal: "'_' must separate successive digits in \"100_\""}, {Type: token.SEMICOLON, Literal: ";"}}},
+		{"1_.5", []token.Token{{Type: token.ILLEGAL, Literal: "'_' must separate successive digits in \"1_.5\""}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range append(tt.expected, token.Token{Type: token.EOF}) {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q: tokens[%d] - expected=%s %q, got=%s %q", tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+				break
+			}
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 10 / 2; // trailing
+/* block
+   comment */ x /**/ + 1;
+`
+
+	tests := []struct {
+		mode     Mode
+		expected []token.Token
+	}{
+		{
+			0,
+			[]token.Token{
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "10"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.PLUS, Literal: "+"},
+				{Type: token.INT, Literal: "1"},
+				{Type: token.SEMICOLON, Literal: ";"},
+			},
+		},
+		{
+			ScanComments,
+			[]token.Token{
+				{Type: token.COMMENT, Literal: "// leading comment"},
+				{Type: token.LET, Literal: "let"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ASSIGN, Literal: "="},
+				{Type: token.INT, Literal: "10"},
+				{Type: token.SLASH, Literal: "/"},
+				{Type: token.INT, Literal: "2"},
+				{Type: token.SEMICOLON, Literal: ";"},
+				{Type: token.COMMENT, Literal: "// trailing"},
+				{Type: token.COMMENT, Literal: "/* block\n   comment */"},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.COMMENT, Literal: "/**/"},
+				{Type: token.PLUS, Literal: "+"},
+				{Type: token.INT, Literal: "1"},
+				{Type: token.SEMICOLON, Literal: ";"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(input)
+		l.SetMode(tt.mode)
+		for i, expected := range append(tt.expected, token.Token{Type: token.EOF}) {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("mode %d: tokens[%d] - expected=%s %q, got=%s %q", tt.mode, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+}
+
+func TestIncompleteEllipsis(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{".", "unexpected character '.'"},
+		{"..a", `unexpected "..", expected "..."`},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != token.ILLEGAL || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q: expected=%s %q, got=%s %q", tt.input, token.ILLEGAL, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("x /* never\nclosed")
+	l.NextToken()
+
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "unterminated block comment" {
+		t.Fatalf("wrong token. expected=%s %q, got=%s %q", token.ILLEGAL, "unterminated block comment", tok.Type, tok.Literal)
+	}
+
+	expectedStart := token.Position{Line: 1, Column: 3}
+	if tok.Span.Start != expectedStart {
+		t.Errorf("wrong start position. expected=%s, got=%s", expectedStart, tok.Span.Start)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF after the comment. got=%s", tok.Type)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{
+			`"total: ${a + b}!"`,
+			[]token.Token{
+				{Type: token.TEMPLATE_HEAD, Literal: "total: "},
+				{Type: token.IDENT, Literal: "a"},
+				{Type: token.PLUS, Literal: "+"},
+				{Type: token.IDENT, Literal: "b"},
+				{Type: token.TEMPLATE_TAIL, Literal: "!"},
+			},
+		},
+		{
+			`"${x}-${y}"`,
+			[]token.Token{
+				{Type: token.TEMPLATE_HEAD, Literal: ""},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.TEMPLATE_MIDDLE, Literal: "-"},
+				{Type: token.IDENT, Literal: "y"},
+				{Type: token.TEMPLATE_TAIL, Literal: ""},
+			},
+		},
+		{
+			`"a ${ {"k": "${v}"}["k"] } b" {}`,
+			[]token.Token{
+				{Type: token.TEMPLATE_HEAD, Literal: "a "},
+				{Type: token.LBRACE, Literal: "{"},
+				{Type: token.STRING, Literal: "k"},
+				{Type: token.COLON, Literal: ":"},
+				{Type: token.TEMPLATE_HEAD, Literal: ""},
+				{Type: token.IDENT, Literal: "v"},
+				{Type: token.TEMPLATE_TAIL, Literal: ""},
+				{Type: token.RBRACE, Literal: "}"},
+				{Type: token.LBRACKET, Literal: "["},
+				{Type: token.STRING, Literal: "k"},
+				{Type: token.RBRACKET, Literal: "]"},
+				{Type: token.TEMPLATE_TAIL, Literal: " b"},
+				{Type: token.LBRACE, Literal: "{"},
+				{Type: token.RBRACE, Literal: "}"},
+			},
+		},
+		{
+			`"cost: \${5} $ {x} $"`,
+			[]token.Token{
+				{Type: token.STRING, Literal: "cost: ${5} $ {x} $"},
+			},
+		},
+		{
+			`"${x} unterminated`,
+			[]token.Token{
+				{Type: token.TEMPLATE_HEAD, Literal: ""},
+				{Type: token.IDENT, Literal: "x"},
+				{Type: token.ILLEGAL, Literal: "encountered EOF before string end"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range append(tt.expected, token.Token{Type: token.EOF}) {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("%s: tokens[%d] - expected=%s %q, got=%s %q", tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"tab\tquote\"backslash\\"`, token.STRING, "tab\tquote\"backslash\\"},
+		{`"\x41\x7a\xe9"`, token.STRING, "Azé"},
+		{`"\u{48}\u{e9}\u{1F600}"`, token.STRING, "Hé😀"},
+		{`"a\0b"`, token.STRING, "a\x00b"},
+		{`"\$\{"`, token.ILLEGAL, `invalid escape sequence \{`},
+		{`"\q"`, token.ILLEGAL, `invalid escape sequence \q`},
+		{`"\x4"`, token.ILLEGAL, `\x escape must be followed by 2 hexadecimal digits`},
+		{`"\xZZ"`, token.ILLEGAL, `\x escape must be followed by 2 hexadecimal digits`},
+		{`"\u0041"`, token.ILLEGAL, `\u escape must be followed by a code point between braces: \u{1F600}`},
+		{`"\u{41"`, token.ILLEGAL, `unterminated \u{...} escape`},
+		{`"\u{}"`, token.ILLEGAL, `invalid code point in \u{} escape`},
+		{`"\u{110000}"`, token.ILLEGAL, `invalid code point in \u{110000} escape`},
+		{`"\u{D800}"`, token.ILLEGAL, `invalid code point in \u{D800} escape`},
+		{`"\u{0000041}"`, token.ILLEGAL, `invalid code point in \u{0000041} escape`},
+		{"`raw \\n ${x} \"quoted\"\nsecond line`", token.STRING, "raw \\n ${x} \"quoted\"\nsecond line"},
+		{"``", token.STRING, ""},
+		{"`never closed", token.ILLEGAL, "encountered EOF before raw string end"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%s: expected=%s %q, got=%s %q", tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%s: lexing didn't resume after the string. got=%s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestRawStringPositions(t *testing.T) {
+	l := New("`a\nbc` x")
+	l.NextToken()
+
+	tok := l.NextToken()
+	expectedStart := token.Position{Line: 2, Column: 5}
+	if tok.Type != token.IDENT || tok.Span.Start != expectedStart {
+		t.Errorf("wrong token after raw string. expected=%s at %s, got=%s at %s", token.IDENT, expectedStart, tok.Type, tok.Span.Start)
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	tests := []struct {
+		input           string
+		mode            Mode
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"café", 0, token.IDENT, "café"},
+		{"πr2", 0, token.IDENT, "πr2"},
+		{"данные", 0, token.IDENT, "данные"},
+		{"変数_1", 0, token.IDENT, "変数_1"},
+		{"x\u0661", 0, token.IDENT, "x\u0661"},                         // Arabic-Indic digit
+		{"\u216B", 0, token.IDENT, "\u216B"},                           // Letter number
+		{"1été", 0, token.IDENT, "1été"},                               // Digits followed by letters
+		{"\u0301x", 0, token.ILLEGAL, "unexpected character '\u0301'"}, // A combining mark can't start an identifier
+		{"cafe\u0301", 0, token.IDENT, "cafe\u0301"},
+		{"cafe\u0301", NormalizeIdentifiers, token.IDENT, "caf\u00e9"},
+		{"\uff4c\uff45\uff54", NormalizeIdentifiers, token.IDENT, "\uff4c\uff45\uff54"}, // NFC doesn't fold compatibility chars
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		l.SetMode(tt.mode)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q: expected=%s %q, got=%s %q", tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestReaderInput(t *testing.T) {
+	input := "let café = `raw\nstring`; // comment\n\"a ${x + 1} b\" /* block */ 0x1F 1.5e3 == !=;"
+
+	expected := New(input)
+	l := NewReader(iotest.OneByteReader(strings.NewReader(input)))
+	for {
+		expectedToken := expected.NextToken()
+		tok := l.NextToken()
+		if tok != expectedToken {
+			t.Fatalf("wrong token. expected=%+v, got=%+v", expectedToken, tok)
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if l.Err() != nil {
+		t.Errorf("unexpected read error: %v", l.Err())
+	}
+}
+
+func TestReaderLargeInput(t *testing.T) {
+	const statements = 100000
+	statement := "let x = 1;\n"
+	l := NewReader(strings.NewReader(strings.Repeat(statement, statements)))
+
+	count := 0
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		count++
+		last = tok
+	}
+
+	if count != statements*5 {
+		t.Errorf("wrong token count. expected=%d, got=%d", statements*5, count)
+	}
+	expectedStart := token.Position{Line: statements, Column: 10}
+	if last.Type != token.SEMICOLON || last.Span.Start != expectedStart {
+		t.Errorf("wrong last token. expected=%s at %s, got=%s at %s", token.SEMICOLON, expectedStart, last.Type, last.Span.Start)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	readError := errors.New("read failure")
+	l := NewReader(io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(readError)))
+
+	expectedTypes := []token.TokenType{token.LET, token.IDENT, token.EOF}
+	for _, expectedType := range expectedTypes {
+		tok := l.NextToken()
+		if tok.Type != expectedType {
+			t.Fatalf("wrong token type. expected=%s, got=%s", expectedType, tok.Type)
+		}
+	}
+	if !errors.Is(l.Err(), readError) {
+		t.Errorf("wrong read error. expected=%v, got=%v", readError, l.Err())
+	}
+}
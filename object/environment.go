@@ -28,3 +28,15 @@ func (e *Environment) Get(name string) (Object, bool) {
 func (e *Environment) Set(name string, obj Object) {
 	e.store[name] = obj
 }
+
+// Update an existing binding in the environment where it is defined, returns false if the name is not defined
+func (e *Environment) Assign(name string, obj Object) bool {
+	if _, found := e.store[name]; found {
+		e.store[name] = obj
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, obj)
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package object
+
+import "testing"
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("y", &Integer{Value: 2})
+
+	if !inner.Assign("x", &Integer{Value: 10}) {
+		t.Fatalf("assigning x from the enclosed environment failed")
+	}
+	if _, found := inner.store["x"]; found {
+		t.Errorf("x was bound in the enclosed environment instead of being updated in the outer one")
+	}
+	if x, _ := outer.Get("x"); x.(*Integer).Value != 10 {
+		t.Errorf("x was not updated in the outer environment. got=%s", x.Inspect())
+	}
+
+	if !inner.Assign("y", &Integer{Value: 20}) {
+		t.Fatalf("assigning y failed")
+	}
+	if y, _ := inner.Get("y"); y.(*Integer).Value != 20 {
+		t.Errorf("y was not updated. got=%s", y.Inspect())
+	}
+
+	if inner.Assign("z", &Integer{Value: 3}) {
+		t.Errorf("assigning an undefined name succeeded")
+	}
+	if _, found := inner.Get("z"); found {
+		t.Errorf("assigning an undefined name created a binding")
+	}
+}
@@ -3,17 +3,24 @@ package object
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/valsov/gointerpreter/ast"
+	"github.com/valsov/gointerpreter/token"
 )
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTIN"
@@ -21,6 +28,9 @@ const (
 	HASH_OBJ         = "HASH"
 )
 
+// Hash key type of big integers, keeps their keys apart from the Integer ones
+const bigIntegerHashType ObjectType = "BIG_INTEGER"
+
 var hashKeyCache = map[Hashable]HashKey{}
 
 type ObjectType string
@@ -37,6 +47,36 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// Integer that doesn't fit in an int64, values that fit must use Integer
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Inspect() string  { return bi.Value.String() }
+func (bi *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+
+// Smallest representation of an integer value: an Integer when it fits in an int64, a BigInteger otherwise
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+type Float struct {
+	Value float64
+}
+
+// Shortest representation that parses back to the same value, always keeping a fraction or an exponent
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if math.IsInf(f.Value, 0) || math.IsNaN(f.Value) || strings.ContainsAny(str, ".e") {
+		return str
+	}
+	return str + ".0"
+}
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
 type String struct {
 	Value string
 }
@@ -63,32 +103,84 @@ type ReturnValue struct {
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 
+// Signal propagated from a break statement up to the enclosing loop
+type Break struct{}
+
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+
+// Signal propagated from a continue statement up to the enclosing loop
+type Continue struct{}
+
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+
+// Number of frames rendered at each end of a long stack trace, the ones in between are elided
+const tracedFramesLimit = 10
+
 type Error struct {
 	Message string
+	Span    token.Span // Source of the innermost node that raised the error
+	Trace   []Frame    // Calls that were active when the error was raised, the innermost one first
 }
 
-func (e *Error) Inspect() string  { return fmt.Sprintf("ERROR: %s", e.Message) }
+func (e *Error) Inspect() string {
+	var out strings.Builder
+	if e.Span.Start.IsValid() {
+		fmt.Fprintf(&out, "ERROR: %s: %s", e.Span.Start, e.Message)
+	} else {
+		fmt.Fprintf(&out, "ERROR: %s", e.Message)
+	}
+
+	for i, frame := range e.Trace {
+		if len(e.Trace) > 2*tracedFramesLimit && i >= tracedFramesLimit && i < len(e.Trace)-tracedFramesLimit {
+			if i == tracedFramesLimit {
+				fmt.Fprintf(&out, "\n\t... %d more calls", len(e.Trace)-2*tracedFramesLimit)
+			}
+			continue
+		}
+		fmt.Fprintf(&out, "\n\t%s", frame)
+	}
+	return out.String()
+}
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 
+// Function call active when an error was raised
+type Frame struct {
+	Function string // Name the function was bound to, empty for anonymous functions
+	CallSite token.Position
+}
+
+func (f Frame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "anonymous function"
+	}
+	return fmt.Sprintf("in %s called at %s", name, f.CallSite)
+}
+
 type Function struct {
+	Name       string // Name of the binding the function was first assigned to, empty for anonymous functions
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // Evaluated at call time for the missing arguments, nil for the required parameters
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
 
 func (f *Function) Inspect() string {
-	parameters := []string{}
-	for _, p := range f.Parameters {
-		parameters = append(parameters, p.String())
-	}
-	return fmt.Sprintf("fn(%s) {\n%s\n}", strings.Join(parameters, ", "), f.Body.String())
+	return fmt.Sprintf("fn(%s) {\n%s\n}", ast.FormatParameters(f.Parameters, f.Defaults, f.Rest), f.Body.String())
 }
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 
 type BuiltinFunction func(args ...Object) Object
 
+// Builtins declare their signature, the number of arguments is checked before Fn is called
 type Builtin struct {
-	Fn BuiltinFunction
+	Name       string
+	Parameters []string
+	Variadic   bool // Any number of arguments is accepted after Parameters
+	Fn         BuiltinFunction
 }
 
 func (bi *Builtin) Inspect() string  { return "built-in function" }
@@ -111,21 +203,45 @@ type HashPair struct {
 	Key, Value Object
 }
 
+// Pairs must be added with Set to keep track of the insertion order
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	keys  []HashKey // Insertion order of the keys
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: map[HashKey]HashPair{}}
 }
 
 func (h *Hash) Inspect() string {
-	pairs := make([]string, len(h.Pairs))
-	i := 0
-	for _, pair := range h.Pairs {
-		pairs[i] = fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect())
-		i++
+	pairs := []string{}
+	for _, pair := range h.OrderedPairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 
+// Insert or update a pair, an updated key keeps its original position
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = map[HashKey]HashPair{}
+	}
+	if _, found := h.Pairs[key]; !found {
+		h.keys = append(h.keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+// Pairs in insertion order
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, len(h.keys))
+	for i, key := range h.keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -162,6 +278,44 @@ func (i *Integer) HashKey() HashKey {
 	return hashKey
 }
 
+func (bi *BigInteger) HashKey() HashKey {
+	if hashKey, found := hashKeyCache[bi]; found {
+		return hashKey
+	}
+	hashKey := bigIntegerHashKey(bi.Value)
+	hashKeyCache[bi] = hashKey
+	return hashKey
+}
+
+func bigIntegerHashKey(value *big.Int) HashKey {
+	hash := fnv.New64a()
+	hash.Write([]byte{byte(value.Sign() + 1)})
+	hash.Write(value.Bytes())
+	return HashKey{Type: bigIntegerHashType, Value: hash.Sum64()}
+}
+
+// Whole floats share the key of the equal integer, so that numbers comparing equal find the same hash entry
+func (f *Float) HashKey() HashKey {
+	if hashKey, found := hashKeyCache[f]; found {
+		return hashKey
+	}
+
+	var hashKey HashKey
+	value := f.Value
+	switch {
+	case value >= math.MinInt64 && value < math.MaxInt64 && value == math.Trunc(value):
+		// -0.0 is converted to 0 too, it equals 0.0
+		hashKey = HashKey{Type: INTEGER_OBJ, Value: uint64(int64(value))}
+	case !math.IsInf(value, 0) && value == math.Trunc(value):
+		integer, _ := big.NewFloat(value).Int(nil)
+		hashKey = bigIntegerHashKey(integer)
+	default:
+		hashKey = HashKey{Type: f.Type(), Value: math.Float64bits(value)}
+	}
+	hashKeyCache[f] = hashKey
+	return hashKey
+}
+
 func (s *String) HashKey() HashKey {
 	if hashKey, found := hashKeyCache[s]; found {
 		return hashKey
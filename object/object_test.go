@@ -1,6 +1,14 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/valsov/gointerpreter/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +66,128 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestErrorInspect(t *testing.T) {
+	err := &Error{Message: "boom", Span: token.Span{Start: token.Position{Line: 2, Column: 3}}}
+	for i := 0; i < 25; i++ {
+		err.Trace = append(err.Trace, Frame{Function: fmt.Sprintf("f%d", i), CallSite: token.Position{Line: i + 1, Column: 1}})
+	}
+
+	lines := strings.Split(err.Inspect(), "\n")
+	expected := []string{
+		"ERROR: 2:3: boom",
+		"\tin f0 called at 1:1",
+		"\tin f9 called at 10:1",
+		"\t... 5 more calls",
+		"\tin f15 called at 16:1",
+		"\tin f24 called at 25:1",
+	}
+	if len(lines) != 22 {
+		t.Fatalf("wrong number of lines. expected=22, got=%d", len(lines))
+	}
+	for i, line := range []string{lines[0], lines[1], lines[10], lines[11], lines[12], lines[21]} {
+		if line != expected[i] {
+			t.Errorf("wrong line. expected=%q, got=%q", expected[i], line)
+		}
+	}
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	for _, key := range []string{"b", "a", "c"} {
+		k := &String{Value: key}
+		hash.Set(k.HashKey(), HashPair{Key: k, Value: &Integer{Value: 1}})
+	}
+	a := &String{Value: "a"}
+	hash.Set(a.HashKey(), HashPair{Key: a, Value: &Integer{Value: 2}})
+
+	expected := "{b: 1, a: 2, c: 1}"
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. expected=%q, got=%q", expected, hash.Inspect())
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	half1 := &Float{Value: 0.5}
+	half2 := &Float{Value: 0.5}
+	zero := &Float{Value: 0}
+	negativeZero := &Float{Value: math.Copysign(0, -1)}
+	one := &Integer{Value: 1}
+	oneFloat := &Float{Value: 1}
+	large := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}
+	largeFloat := &Float{Value: math.Ldexp(1, 70)}
+
+	if half1.HashKey() != half2.HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+
+	if !math.Signbit(negativeZero.Value) {
+		t.Fatalf("negative zero has no sign bit")
+	}
+
+	if zero.HashKey() != negativeZero.HashKey() {
+		t.Errorf("0.0 and -0.0 have different hash keys")
+	}
+
+	if one.HashKey() != oneFloat.HashKey() {
+		t.Errorf("integer and equal whole float have different hash keys")
+	}
+
+	if large.HashKey() != largeFloat.HashKey() {
+		t.Errorf("big integer and equal whole float have different hash keys")
+	}
+
+	if one.HashKey() == (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("integer and fractional float have same hash key")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{3.14159, "3.14159"},
+		{1e21, "1e+21"},
+		{1.5e-7, "1.5e-07"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect() for %v. expected=%q, got=%q", tt.value, tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	value, _ := new(big.Int).SetString("18446744073709551616", 10)
+	big1 := &BigInteger{Value: value}
+	big2 := &BigInteger{Value: new(big.Int).Set(value)}
+	negative := &BigInteger{Value: new(big.Int).Neg(value)}
+
+	if big1.HashKey() != big2.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+
+	if big1.HashKey() == negative.HashKey() {
+		t.Errorf("big integers with opposite values have same hash key")
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	if _, ok := NewInteger(big.NewInt(42)).(*Integer); !ok {
+		t.Errorf("value fitting in an int64 is not an Integer")
+	}
+
+	value, _ := new(big.Int).SetString("-9223372036854775809", 10)
+	bigInteger, ok := NewInteger(value).(*BigInteger)
+	if !ok {
+		t.Fatalf("value overflowing an int64 is not a BigInteger")
+	}
+	if bigInteger.Type() != INTEGER_OBJ || bigInteger.Inspect() != "-9223372036854775809" {
+		t.Errorf("wrong big integer. got=%s %s", bigInteger.Type(), bigInteger.Inspect())
+	}
+}
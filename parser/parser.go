@@ -2,36 +2,66 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/valsov/gointerpreter/ast"
+	"github.com/valsov/gointerpreter/diagnostic"
 	"github.com/valsov/gointerpreter/lexer"
 	"github.com/valsov/gointerpreter/token"
 )
 
 const (
 	LOWEST        int = iota
+	ASSIGN            // = +=
+	TERNARY           // a ? b : c
+	OR                // ||
+	AND               // &&
+	BITWISE_OR        // |
+	BITWISE_XOR       // ^
+	BITWISE_AND       // &
 	EQUALS            // ==
-	LESSORGREATER     // < >
+	LESSORGREATER     // < > <= >=
+	SHIFT             // << >>
 	SUM               // +
 	PRODUCT           // *
 	PREFIX            // -x !x
+	POSTFIX           // x++
 	CALL              // functionCall(x)
 	INDEX             // Arr[i]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSORGREATER,
-	token.GT:       LESSORGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.MODULO:   PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.MODULO_ASSIGN:   ASSIGN,
+	token.QMARK:           TERNARY,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.BIT_OR:          BITWISE_OR,
+	token.BIT_XOR:         BITWISE_XOR,
+	token.BIT_AND:         BITWISE_AND,
+	token.LT:              LESSORGREATER,
+	token.GT:              LESSORGREATER,
+	token.LT_EQ:           LESSORGREATER,
+	token.GT_EQ:           LESSORGREATER,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.MODULO:          PRODUCT,
+	token.INCREMENT:       POSTFIX,
+	token.DECREMENT:       POSTFIX,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -43,7 +73,14 @@ type Parser struct {
 	l                    *lexer.Lexer
 	currentToken         token.Token
 	peekToken            token.Token
-	errors               []string
+	previousEnd          token.Position // End of the token preceding currentToken
+	errors               []diagnostic.Diagnostic
+	panicMode            bool // Set once an error is reported in the current statement, silences follow-on errors until recovery
+	blockDepth           int  // Number of enclosing block statements
+	loopDepth            int  // Number of enclosing loops in the current function
+	readErrorReported    bool
+	pendingComments      []*ast.Comment
+	comments             map[ast.Node][]*ast.Comment
 	prefixParseFunctions map[token.TokenType]prefixParseFn
 	infixParseFunctions  map[token.TokenType]infixParseFn
 }
@@ -51,7 +88,7 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:                    l,
-		errors:               []string{},
+		errors:               []diagnostic.Diagnostic{},
 		prefixParseFunctions: make(map[token.TokenType]prefixParseFn),
 		infixParseFunctions:  make(map[token.TokenType]infixParseFn),
 	}
@@ -59,16 +96,22 @@ func New(l *lexer.Lexer) *Parser {
 	// Register expression parsers
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
+	p.registerPrefix(token.INCREMENT, p.parsePrefixUpdateExpression)
+	p.registerPrefix(token.DECREMENT, p.parsePrefixUpdateExpression)
 
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
@@ -79,8 +122,26 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.QMARK, p.parseConditionalExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MODULO_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.INCREMENT, p.parsePostfixUpdateExpression)
+	p.registerInfix(token.DECREMENT, p.parsePostfixUpdateExpression)
 
 	// Init token cursors
 	p.nextToken()
@@ -89,13 +150,39 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []diagnostic.Diagnostic {
 	return p.errors
 }
 
 func (p *Parser) nextToken() {
+	p.previousEnd = p.currentToken.Span.End
 	p.currentToken = p.peekToken
 	p.peekToken = p.l.NextToken() // Get from lexer
+	for p.peekTokenIs(token.COMMENT) {
+		p.pendingComments = append(p.pendingComments, &ast.Comment{Token: p.peekToken})
+		p.peekToken = p.l.NextToken()
+	}
+}
+
+// Remove and return the pending comments starting before the given position
+func (p *Parser) takeComments(end token.Position) []*ast.Comment {
+	count := 0
+	for count < len(p.pendingComments) && p.pendingComments[count].Token.Span.Start.Before(end) {
+		count++
+	}
+	comments := p.pendingComments[:count:count]
+	p.pendingComments = p.pendingComments[count:]
+	return comments
+}
+
+func (p *Parser) attachComments(node ast.Node, comments []*ast.Comment) {
+	if len(comments) == 0 {
+		return
+	}
+	if p.comments == nil {
+		p.comments = map[ast.Node][]*ast.Comment{}
+	}
+	p.comments[node] = append(p.comments[node], comments...)
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -106,18 +193,97 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFunctions[tokenType] = fn
 }
 
+// When the lexer scans comments, each comment is attached to the statement following or containing it. Comments
+// with no statement after them in their block are attached to the block, or to the program at the top level
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{Statements: []ast.Statement{}}
 
-	for !p.currentTokenIs(token.EOF) {
-		statement := p.parseStatement()
+	for statement, ok := p.ParseNext(); ok; statement, ok = p.ParseNext() {
+		program.Statements = append(program.Statements, statement)
+	}
+
+	p.attachComments(program, p.takeComments(p.currentToken.Span.End))
+	program.Comments = p.comments
+	return program
+}
+
+// Parse the next top-level statement, reading only the tokens it needs from the lexer. The returned boolean is
+// false once the end of the input is reached. Errors are collected as with ParseProgram, including the error of the
+// lexer's reader if it stopped the input early
+func (p *Parser) ParseNext() (ast.Statement, bool) {
+	if p.currentTokenIs(token.EOF) {
+		// A failing reader ends the input early, the program is truncated
+		if err := p.l.Err(); err != nil && !p.readErrorReported {
+			p.readErrorReported = true
+			p.addError(p.currentToken, diagnostic.ReadError, "could not read input: %v", err)
+		}
+		return nil, false
+	}
+	return p.parseRecoverableStatement(), true
+}
+
+// Parse a statement and advance past it. If an error is reported while parsing it, the statement is replaced
+// by an ast.BadStatement and tokens are skipped up to the next synchronization point
+func (p *Parser) parseRecoverableStatement() ast.Statement {
+	start := p.currentToken
+	outerPanicMode := p.panicMode
+	p.panicMode = false
+	defer func() { p.panicMode = outerPanicMode }()
+
+	// Take the leading comments first, nested statements would claim them otherwise
+	leadingComments := p.takeComments(start.Span.Start)
+
+	statement := p.parseStatement()
+	if !p.panicMode {
 		if statement != nil {
-			program.Statements = append(program.Statements, statement)
+			p.attachComments(statement, append(leadingComments, p.takeComments(p.currentToken.Span.End)...))
 		}
 		p.nextToken()
+		return statement
 	}
 
-	return program
+	p.synchronize(start)
+	badStatement := &ast.BadStatement{Token: start, End: p.previousEnd}
+	p.attachComments(badStatement, append(leadingComments, p.takeComments(badStatement.End)...))
+	return badStatement
+}
+
+// Skip tokens until the start of the next statement: past a ';', before the '}' closing the enclosing block, or
+// before a statement keyword. Braces opened while skipping are matched so nested blocks are skipped as a whole
+func (p *Parser) synchronize(start token.Token) {
+	if p.currentToken == start {
+		p.nextToken() // Ensure progress when the statement failed on its first token
+	}
+
+	depth := 0
+	for !p.currentTokenIs(token.EOF) {
+		switch {
+		case p.currentTokenIs(token.LBRACE):
+			depth++
+		case p.currentTokenIs(token.RBRACE):
+			if depth == 0 && p.blockDepth > 0 {
+				return
+			}
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && p.currentTokenIs(token.SEMICOLON):
+			p.nextToken()
+			return
+		case depth == 0 && isStatementKeyword(p.currentToken.Type):
+			return
+		}
+		p.nextToken()
+	}
+}
+
+func isStatementKeyword(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -126,6 +292,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -170,6 +342,146 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	return &statement
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	statement := &ast.WhileStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	statement.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	statement := &ast.ForStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	if p.currentTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		return p.parseForInStatement(statement.Token)
+	}
+
+	// Parse init clause, the parsed statement may already include the ';'
+	if !p.currentTokenIs(token.SEMICOLON) {
+		if p.currentTokenIs(token.LET) {
+			statement.Init = p.parseLetStatement()
+		} else {
+			statement.Init = p.parseExpressionStatement()
+		}
+
+		if !p.currentTokenIs(token.SEMICOLON) && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	// Parse condition clause
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		statement.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	// Parse update clause
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		statement.Update = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseForInStatement(forToken token.Token) ast.Statement {
+	statement := &ast.ForInStatement{
+		Token: forToken,
+		Names: []*ast.Identifier{{Token: p.currentToken, Value: p.currentToken.Literal}},
+	}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		statement.Names = append(statement.Names, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	statement.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var statement ast.Statement
+	if p.currentTokenIs(token.BREAK) {
+		statement = &ast.BreakStatement{Token: p.currentToken}
+	} else {
+		statement = &ast.ContinueStatement{Token: p.currentToken}
+	}
+
+	if p.loopDepth == 0 {
+		p.addError(p.currentToken, diagnostic.OutsideLoop, "%s statement outside of a loop", p.currentToken.Literal)
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return statement
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	statement := &ast.ExpressionStatement{Token: p.currentToken}
 	statement.Expression = p.parseExpression(LOWEST)
@@ -183,7 +495,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFunctions[p.currentToken.Type]
 	if prefix == nil {
-		p.errors = append(p.errors, fmt.Sprintf("no prefix parse function for '%s' found", p.currentToken.Type))
+		p.addError(p.currentToken, diagnostic.ExpectedExpression, "no prefix parse function for '%s' found", p.currentToken.Type)
 		return nil
 	}
 	exp := prefix()
@@ -208,12 +520,24 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	}
 }
 
+// Report the problem detected by the lexer, the literal of an illegal token holds its description
+func (p *Parser) parseIllegal() ast.Expression {
+	p.addError(p.currentToken, diagnostic.IllegalToken, "%s", p.currentToken.Literal)
+	return nil
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	intLit := &ast.IntegerLiteral{Token: p.currentToken}
 
-	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
+	digits, base := integerDigits(p.currentToken.Literal)
+	value, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("could not parase %q as integer", p.currentToken.Literal))
+		// Literals too large for an int64 are kept as big integers
+		if bigValue, ok := new(big.Int).SetString(digits, base); ok {
+			intLit.Big = bigValue
+			return intLit
+		}
+		p.addError(p.currentToken, diagnostic.InvalidInteger, "could not parse %q as integer", p.currentToken.Literal)
 		return nil
 	}
 
@@ -221,6 +545,36 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return intLit
 }
 
+// Split an integer literal into its digits, without separators, and its base. Literals without a 0x, 0o or 0b
+// prefix are decimal, leading zeros included
+func integerDigits(literal string) (string, int) {
+	digits := strings.ReplaceAll(literal, "_", "")
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			return digits[2:], 16
+		case 'o', 'O':
+			return digits[2:], 8
+		case 'b', 'B':
+			return digits[2:], 2
+		}
+	}
+	return digits, 10
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	floatLit := &ast.FloatLiteral{Token: p.currentToken}
+
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		p.addError(p.currentToken, diagnostic.InvalidFloat, "could not parse %q as float", p.currentToken.Literal)
+		return nil
+	}
+
+	floatLit.Value = value
+	return floatLit
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.currentToken,
@@ -246,9 +600,84 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Target:   target,
+	}
+
+	if !p.checkAssignable(target) {
+		return nil
+	}
+
+	// Parse with a lower precedence to make the operator right associative
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
+func (p *Parser) parsePrefixUpdateExpression() ast.Expression {
+	expression := &ast.UpdateExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Prefix:   true,
+	}
+	p.nextToken()
+
+	expression.Target = p.parseExpression(PREFIX)
+	if !p.checkAssignable(expression.Target) {
+		return nil
+	}
+	return expression
+}
+
+func (p *Parser) parsePostfixUpdateExpression(target ast.Expression) ast.Expression {
+	if !p.checkAssignable(target) {
+		return nil
+	}
+	return &ast.UpdateExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Target:   target,
+	}
+}
+
+// Only variables and indexed elements can be assigned, report an error for any other expression. Once an error was
+// reported the target may be partly parsed, it is not formatted then
+func (p *Parser) checkAssignable(target ast.Expression) bool {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return true
+	}
+	if target != nil && !p.panicMode {
+		p.addError(p.currentToken, diagnostic.InvalidTarget, "cannot assign to %s", target.String())
+	}
+	return false
+}
+
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.currentToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	// Parse with a lower precedence to make the operator right associative
+	p.nextToken()
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+	return expression
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: p.currentToken, Function: function}
 	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.currentTokenIs(token.RPAREN) {
+		expression.End = p.currentToken.Span.End
+	}
 	return expression
 }
 
@@ -260,6 +689,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	expression.End = p.currentToken.Span.End
 	return expression
 }
 
@@ -303,8 +733,24 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	expression.Consequence = p.parseBlockStatement()
 
 	if p.peekTokenIs(token.ELSE) {
-		// Parse code in else block
 		p.nextToken()
+
+		if p.peekTokenIs(token.IF) {
+			// Parse else if: the alternative block only holds the nested if expression
+			p.nextToken()
+			ifToken := p.currentToken
+			nested := p.parseIfExpression()
+			if nested == nil {
+				return nil
+			}
+			expression.Alternative = &ast.BlockStatement{
+				Token:      ifToken,
+				Statements: []ast.Statement{&ast.ExpressionStatement{Token: ifToken, Expression: nested}},
+			}
+			return expression
+		}
+
+		// Parse code in else block
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -320,13 +766,17 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	funLiteral.Parameters = p.parseFunctionParameters()
+	p.parseFunctionParameters(funLiteral)
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	// Loops enclosing the function literal cannot be controlled from its body
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
 	funLiteral.Body = p.parseBlockStatement()
+	p.loopDepth = outerLoopDepth
 
 	return funLiteral
 }
@@ -338,11 +788,40 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	}
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	expression := &ast.InterpolatedString{Token: p.currentToken}
+	expression.Parts = append(expression.Parts, p.parseStringLiteral())
+
+	for {
+		p.nextToken()
+		if p.currentTokenIs(token.TEMPLATE_MIDDLE) || p.currentTokenIs(token.TEMPLATE_TAIL) {
+			p.addError(p.currentToken, diagnostic.ExpectedExpression, "empty string interpolation")
+			return nil
+		}
+		expression.Parts = append(expression.Parts, p.parseExpression(LOWEST))
+
+		switch {
+		case p.peekTokenIs(token.TEMPLATE_MIDDLE):
+			p.nextToken()
+			expression.Parts = append(expression.Parts, p.parseStringLiteral())
+		case p.peekTokenIs(token.TEMPLATE_TAIL):
+			p.nextToken()
+			expression.Parts = append(expression.Parts, p.parseStringLiteral())
+			return expression
+		default:
+			p.unexpectedTokenError(p.peekToken, token.TEMPLATE_MIDDLE, token.TEMPLATE_TAIL)
+			return nil
+		}
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
-		Token:    p.currentToken,
-		Elements: p.parseExpressionList(token.RBRACKET),
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.currentTokenIs(token.RBRACKET) {
+		array.End = p.currentToken.Span.End
 	}
+	return array
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
@@ -353,6 +832,13 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
+		if p.currentTokenIs(token.ELLIPSIS) {
+			hash.Pairs = append(hash.Pairs, ast.ExpressionPair{Key: p.parseSpreadExpression()})
+			if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			continue
+		}
 		key := p.parseExpression(LOWEST)
 
 		if !p.expectPeek(token.COLON) {
@@ -373,38 +859,73 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.End = p.currentToken.Span.End
 	return hash
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// Parse the parameters into the function literal. Once a parameter has a default value, the following ones must
+// have one too. The rest parameter comes last
+func (p *Parser) parseFunctionParameters(funLiteral *ast.FunctionLiteral) {
+	funLiteral.Parameters = []*ast.Identifier{}
+	funLiteral.Defaults = []ast.Expression{}
 
-	for !p.peekTokenIs(token.RPAREN) && !p.peekTokenIs(token.EOF) {
+	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		if p.currentTokenIs(token.COMMA) {
+		return
+	}
+
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
 			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return
+			}
+			funLiteral.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+			break
 		}
-		identifiers = append(identifiers, &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
-	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+		if !p.expectPeek(token.IDENT) {
+			return
+		}
+		parameter := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+		var defaultValue ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			defaultValue = p.parseExpression(LOWEST)
+		} else if n := len(funLiteral.Defaults); n > 0 && funLiteral.Defaults[n-1] != nil {
+			p.addError(p.currentToken, diagnostic.InvalidParameter, "parameter %s without default value follows a parameter with one", parameter.Value)
+			return
+		}
+		funLiteral.Parameters = append(funLiteral.Parameters, parameter)
+		funLiteral.Defaults = append(funLiteral.Defaults, defaultValue)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
-	return identifiers
+	p.expectPeek(token.RPAREN)
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currentToken}
 	p.nextToken()
 
+	p.blockDepth++
 	for !p.currentTokenIs(token.RBRACE) && !p.currentTokenIs(token.EOF) {
-		statement := p.parseStatement()
-		if statement != nil {
-			block.Statements = append(block.Statements, statement)
-		}
-		p.nextToken()
+		block.Statements = append(block.Statements, p.parseRecoverableStatement())
 	}
+	p.blockDepth--
+
+	if p.currentTokenIs(token.EOF) {
+		p.unexpectedTokenError(p.currentToken, token.RBRACE)
+	} else {
+		block.End = p.currentToken.Span.End
+	}
+	p.attachComments(block, p.takeComments(p.currentToken.Span.Start))
 
 	return block
 }
@@ -415,11 +936,11 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		return []ast.Expression{}
 	}
 
-	expressions := []ast.Expression{p.parseExpression(LOWEST)}
+	expressions := []ast.Expression{p.parseListElement()}
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		expressions = append(expressions, p.parseExpression(LOWEST))
+		expressions = append(expressions, p.parseListElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -429,6 +950,21 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return expressions
 }
 
+// Parse an element of a call argument list or of an array literal, which can be spread
+func (p *Parser) parseListElement() ast.Expression {
+	if p.currentTokenIs(token.ELLIPSIS) {
+		return p.parseSpreadExpression()
+	}
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	spread := &ast.SpreadExpression{Token: p.currentToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) currentTokenIs(t token.TokenType) bool {
 	return p.currentToken.Type == t
 }
@@ -439,14 +975,58 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 
 func (p *Parser) expectPeek(t token.TokenType) bool {
 	if !p.peekTokenIs(t) {
-		err := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-		p.errors = append(p.errors, err)
+		p.unexpectedTokenError(p.peekToken, t)
 		return false
 	}
 	p.nextToken()
 	return true
 }
 
+// Record an error located at the given token, unless the parser is already recovering from an error
+func (p *Parser) addError(tok token.Token, code diagnostic.Code, format string, values ...interface{}) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	p.errors = append(p.errors, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, values...),
+		Span:     tok.Span,
+		Found:    tok.Type,
+	})
+}
+
+// Record an error for a token that is not one of the expected types. An illegal token is reported with the lexer's message
+func (p *Parser) unexpectedTokenError(tok token.Token, expected ...token.TokenType) {
+	if p.panicMode {
+		return
+	}
+	p.panicMode = true
+	d := diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     diagnostic.UnexpectedToken,
+		Message:  fmt.Sprintf("expected next token to be %s, got %s instead", joinTokenTypes(expected), tok.Type),
+		Span:     tok.Span,
+		Expected: expected,
+		Found:    tok.Type,
+	}
+	if tok.Type == token.ILLEGAL {
+		// The lexer's message tells what is wrong with the token
+		d.Code = diagnostic.IllegalToken
+		d.Message = tok.Literal
+	}
+	p.errors = append(p.errors, d)
+}
+
+func joinTokenTypes(types []token.TokenType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, " or ")
+}
+
 func (p *Parser) currentPrecedence() int {
 	if p, ok := precedences[p.currentToken.Type]; ok {
 		return p
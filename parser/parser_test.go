@@ -1,11 +1,18 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/valsov/gointerpreter/ast"
+	"github.com/valsov/gointerpreter/diagnostic"
 	"github.com/valsov/gointerpreter/lexer"
+	"github.com/valsov/gointerpreter/token"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -160,6 +167,108 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0XFF", 255},
+		{"0o17", 15},
+		{"0b101", 5},
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 65535},
+		{"010", 10},
+		{"09", 9},
+		{"0_7", 7},
+		{"00", 0},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		intLiteral, ok := statement.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("expression is not a *ast.IntegerLiteral. got=%T", statement.Expression)
+		}
+		if intLiteral.Value != tt.expected {
+			t.Errorf("%q: intLiteral.Value not %d. got=%d", tt.input, tt.expected, intLiteral.Value)
+		}
+		if intLiteral.String() != tt.input {
+			t.Errorf("%q: intLiteral.String() not %s. got=%s", tt.input, tt.input, intLiteral.String())
+		}
+	}
+}
+
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "9223372036854775808;"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	intLiteral, ok := statement.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("expression is not a *ast.IntegerLiteral. got=%T", statement.Expression)
+	}
+	if intLiteral.Big == nil || intLiteral.Big.String() != "9223372036854775808" {
+		t.Errorf("intLiteral.Big not %s. got=%v", "9223372036854775808", intLiteral.Big)
+	}
+	if intLiteral.String() != "9223372036854775808" {
+		t.Errorf("intLiteral.String() not %s. got=%s", "9223372036854775808", intLiteral.String())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e3;", 1000},
+		{"25E-2;", 0.25},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements doesn't contain 1 statement. got=%d", len(program.Statements))
+		}
+		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		floatLiteral, ok := statement.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("expression is not a *ast.FloatLiteral. got=%T", statement.Expression)
+		}
+		if floatLiteral.Value != tt.expected {
+			t.Errorf("floatLiteral.Value not %g. got=%g", tt.expected, floatLiteral.Value)
+		}
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -202,6 +311,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~15;", "~", 15},
 	}
 
 	for _, tt := range testCases {
@@ -250,6 +360,15 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true;", true, "==", true},
 		{"true != false;", true, "!=", false},
 		{"false == false;", false, "==", false},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false;", true, "&&", false},
+		{"false || true;", false, "||", true},
 	}
 
 	for _, tt := range testCases {
@@ -407,6 +526,130 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a ? b : c",
+			"(a ? b : c)",
+		},
+		{
+			"a == b ? c + 1 : d * 2",
+			"((a == b) ? (c + 1) : (d * 2))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"f(a ? 1 : 2, b)",
+			"f((a ? 1 : 2), b)",
+		},
+		{
+			"{a ? 1 : 2: b ? c ? 3 : 4 : 5}",
+			"{(a ? 1 : 2):(b ? (c ? 3 : 4) : 5)}",
+		},
+		{
+			"x += 1 + 2",
+			"(x += (1 + 2))",
+		},
+		{
+			"x *= y -= 2",
+			"(x *= (y -= 2))",
+		},
+		{
+			"x %= a ? 1 : 2",
+			"(x %= (a ? 1 : 2))",
+		},
+		{
+			"x++ + 1",
+			"((x++) + 1)",
+		},
+		{
+			"-x--",
+			"(-(x--))",
+		},
+		{
+			"++x * 2",
+			"((++x) * 2)",
+		},
+		{
+			"a[--i]",
+			"(a[(--i)])",
+		},
+		{
+			"a = b = c",
+			"(a = (b = c))",
+		},
+		{
+			"x = y == z",
+			"(x = (y == z))",
+		},
+		{
+			"a[0] = 1 + 2",
+			"((a[0]) = (1 + 2))",
+		},
+		{
+			`h["k"] += 2`,
+			"((h[k]) += 2)",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c < d",
+			"((a == b) && (c < d))",
+		},
+		{
+			"!a || b",
+			"((!a) || b)",
+		},
+		{
+			"a && b ? c : d",
+			"((a && b) ? c : d)",
+		},
+		{
+			"x = a || b",
+			"(x = (a || b))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"(a & (b == c))",
+		},
+		{
+			"a << 1 + b >> c",
+			"((a << (1 + b)) >> c)",
+		},
+		{
+			"a < b << c",
+			"(a < (b << c))",
+		},
+		{
+			"~a & -b",
+			"((~a) & (-b))",
+		},
+		{
+			"a || b | c",
+			"(a || (b | c))",
+		},
+		{
+			"m[i][j]++",
+			"(((m[i])[j])++)",
+		},
 	}
 	for _, tt := range testCases {
 		l := lexer.New(tt.input)
@@ -517,6 +760,385 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestIfElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else if (x == 1) { 1 } else { z }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	expectedConditions := []struct {
+		left     interface{}
+		operator string
+		right    interface{}
+	}{
+		{"x", "<", "y"},
+		{"x", ">", "y"},
+		{"x", "==", 1},
+	}
+
+	for i, expected := range expectedConditions {
+		if !testInfixExpression(t, exp.Condition, expected.left, expected.operator, expected.right) {
+			return
+		}
+
+		if len(exp.Alternative.Statements) != 1 {
+			t.Fatalf("branch %d: exp.Alternative.Statements does not contain 1 statement. got=%d", i, len(exp.Alternative.Statements))
+		}
+		alternative := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+
+		if i == len(expectedConditions)-1 {
+			testIdentifier(t, alternative.Expression, "z")
+			break
+		}
+
+		exp, ok = alternative.Expression.(*ast.IfExpression)
+		if !ok {
+			t.Fatalf("branch %d: alternative is not ast.IfExpression. got=%T", i, alternative.Expression)
+		}
+	}
+
+	expected := "if (x < y) x else if (x > y) y else if (x == 1) 1 else z"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x++; if (x == 5) { break; } continue }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("stmt.Body.Statements does not contain 3 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("stmt.Body.Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+
+	expected := "while (x < 10) (x++)if (x == 5) break;continue;"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedInit string
+		expectedCond string
+		expectedStep string
+		expected     string
+	}{
+		{
+			"for (let i = 0; i < 10; i++) { x += i }",
+			"let i = 0;", "(i < 10)", "(i++)",
+			"for (let i = 0; (i < 10); (i++)) (x += i)",
+		},
+		{
+			"for (i = 0; i < 10; i += 2) { break }",
+			"(i = 0)", "(i < 10)", "(i += 2)",
+			"for ((i = 0); (i < 10); (i += 2)) break;",
+		},
+		{
+			"for (;;) { break; }",
+			"", "", "",
+			"for (; ; ) break;",
+		},
+		{
+			"for (; i < 3;) { i++ }",
+			"", "(i < 3)", "",
+			"for (; (i < 3); ) (i++)",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if init := nodeString(stmt.Init); init != tt.expectedInit {
+			t.Errorf("wrong init clause. expected=%q, got=%q", tt.expectedInit, init)
+		}
+		if cond := nodeString(stmt.Condition); cond != tt.expectedCond {
+			t.Errorf("wrong condition clause. expected=%q, got=%q", tt.expectedCond, cond)
+		}
+		if step := nodeString(stmt.Update); step != tt.expectedStep {
+			t.Errorf("wrong update clause. expected=%q, got=%q", tt.expectedStep, step)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedNames []string
+		expected      string
+	}{
+		{"for (x in arr) { sum += x }", []string{"x"}, "for (x in arr) (sum += x)"},
+		{"for (k, v in {1: 2}) { continue }", []string{"k", "v"}, "for (k, v in {1:2}) continue;"},
+		{"for (ch in \"abc\" + s) { break };", []string{"ch"}, "for (ch in (abc + s)) break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForInStatement. got=%T", program.Statements[0])
+		}
+
+		if len(stmt.Names) != len(tt.expectedNames) {
+			t.Fatalf("wrong number of loop variables. expected=%d, got=%d", len(tt.expectedNames), len(stmt.Names))
+		}
+		for i, name := range tt.expectedNames {
+			testIdentifier(t, stmt.Names[i], name)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestParseNext(t *testing.T) {
+	input := "let x = 1; x + 2; let = 3; return x;"
+	p := New(lexer.NewReader(strings.NewReader(input)))
+
+	expected := []string{"let x = 1;", "(x + 2)", "", "return x;"}
+	for i, expectedString := range expected {
+		statement, ok := p.ParseNext()
+		if !ok {
+			t.Fatalf("statement %d: unexpected end of input", i)
+		}
+		if _, isBad := statement.(*ast.BadStatement); isBad != (expectedString == "") {
+			t.Fatalf("statement %d: wrong statement type %T", i, statement)
+		}
+		if expectedString != "" && statement.String() != expectedString {
+			t.Errorf("statement %d: expected=%q, got=%q", i, expectedString, statement.String())
+		}
+	}
+
+	if statement, ok := p.ParseNext(); ok {
+		t.Errorf("expected end of input, got=%q", statement.String())
+	}
+	if len(p.Errors()) != 1 {
+		t.Errorf("wrong number of errors. expected=1, got=%d", len(p.Errors()))
+	}
+}
+
+func TestReadError(t *testing.T) {
+	readError := errors.New("connection reset")
+	reader := io.MultiReader(strings.NewReader("let x = 1; x"), iotest.ErrReader(readError))
+	p := New(lexer.NewReader(reader))
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. expected=2, got=%d", len(program.Statements))
+	}
+	if len(p.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. expected=1, got=%d", len(p.Errors()))
+	}
+
+	d := p.Errors()[0]
+	if d.Code != diagnostic.ReadError {
+		t.Errorf("wrong code. expected=%s, got=%s", diagnostic.ReadError, d.Code)
+	}
+	expected := "1:13: could not read input: connection reset"
+	if d.String() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, d.String())
+	}
+
+	if _, ok := p.ParseNext(); ok || len(p.Errors()) != 1 {
+		t.Errorf("read error reported again after the end of input")
+	}
+}
+
+func TestCommentAttachment(t *testing.T) {
+	input := `// Doubles a number
+let double = fn(x) {
+	// Shift instead of multiplying
+	x << 1 // Same as x * 2
+	// Nothing after this
+};
+let y = /* inline */ double(2);
+// End of file`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "let double = fn(x) (x << 1);let y = double(2);" {
+		t.Fatalf("comments changed the parsed program. got=%q", program.String())
+	}
+
+	letDouble := program.Statements[0].(*ast.LetStatement)
+	body := letDouble.Value.(*ast.FunctionLiteral).Body
+
+	tests := []struct {
+		node     ast.Node
+		expected []string
+	}{
+		{letDouble, []string{"// Doubles a number"}},
+		{body.Statements[0], []string{"// Shift instead of multiplying"}},
+		{body, []string{"// Same as x * 2", "// Nothing after this"}},
+		{program.Statements[1], []string{"/* inline */"}},
+		{program, []string{"// End of file"}},
+	}
+
+	for _, tt := range tests {
+		comments := program.Comments[tt.node]
+		if len(comments) != len(tt.expected) {
+			t.Errorf("wrong comments for %q. expected=%q, got=%v", tt.node.String(), tt.expected, comments)
+			continue
+		}
+		for i, comment := range comments {
+			if comment.String() != tt.expected[i] {
+				t.Errorf("wrong comment for %q. expected=%q, got=%q", tt.node.String(), tt.expected[i], comment.String())
+			}
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	input := `"total: ${a + b * 2} for ${name}"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not a *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+	interpolated, ok := statement.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("expression is not a *ast.InterpolatedString. got=%T", statement.Expression)
+	}
+
+	expectedParts := []string{"total: ", "(a + (b * 2))", " for ", "name", ""}
+	if len(interpolated.Parts) != len(expectedParts) {
+		t.Fatalf("wrong number of parts. expected=%d, got=%d", len(expectedParts), len(interpolated.Parts))
+	}
+	for i, expected := range expectedParts {
+		if interpolated.Parts[i].String() != expected {
+			t.Errorf("wrong part %d. expected=%q, got=%q", i, expected, interpolated.Parts[i].String())
+		}
+	}
+
+	if interpolated.String() != "total: ${(a + (b * 2))} for ${name}" {
+		t.Errorf("interpolated.String() wrong. got=%q", interpolated.String())
+	}
+
+	expectedEnd := token.Position{Line: 1, Column: 34}
+	if interpolated.Span().End != expectedEnd {
+		t.Errorf("wrong end position. expected=%s, got=%s", expectedEnd, interpolated.Span().End)
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`"a ${} b"`, "empty string interpolation"},
+		{`"a ${x y} b"`, "expected next token to be TEMPLATE_MIDDLE or TEMPLATE_TAIL, got IDENT instead"},
+		{`"a ${x`, "expected next token to be TEMPLATE_MIDDLE or TEMPLATE_TAIL, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Fatalf("%q: expected parser errors, got none", tt.input)
+		}
+		if p.Errors()[0].Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. expected=%q, got=%q", tt.input, tt.expectedMessage, p.Errors()[0].Message)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"break;", "break statement outside of a loop"},
+		{"if (true) { continue }", "continue statement outside of a loop"},
+		{"while (true) { let f = fn() { break; }; }", "break statement outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got=%d", tt.input, len(p.Errors()))
+		}
+
+		d := p.Errors()[0]
+		if d.Code != diagnostic.OutsideLoop {
+			t.Errorf("%q: wrong code. expected=%s, got=%s", tt.input, diagnostic.OutsideLoop, d.Code)
+		}
+		if d.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. expected=%q, got=%q", tt.input, tt.expectedMessage, d.Message)
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -587,6 +1209,69 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedString   string
+		expectedDefaults []bool
+		expectedRest     string
+	}{
+		{"fn(a, b = 10) {}", "fn(a, b = 10) ", []bool{false, true}, ""},
+		{"fn(a = 1 + 2, b = a * 2) {}", "fn(a = (1 + 2), b = (a * 2)) ", []bool{true, true}, ""},
+		{"fn(...rest) {}", "fn(...rest) ", []bool{}, "rest"},
+		{"fn(a, b = 10, ...rest) { a }", "fn(a, b = 10, ...rest) a", []bool{false, true}, "rest"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if function.String() != tt.expectedString {
+			t.Errorf("wrong string. expected=%q, got=%q", tt.expectedString, function.String())
+		}
+		if len(function.Defaults) != len(function.Parameters) || len(function.Defaults) != len(tt.expectedDefaults) {
+			t.Fatalf("wrong number of defaults. expected=%d, got=%d", len(tt.expectedDefaults), len(function.Defaults))
+		}
+		for i, hasDefault := range tt.expectedDefaults {
+			if (function.Defaults[i] != nil) != hasDefault {
+				t.Errorf("parameter %d: wrong default. expected present=%t, got=%v", i, hasDefault, function.Defaults[i])
+			}
+		}
+		if tt.expectedRest == "" && function.Rest != nil || tt.expectedRest != "" && (function.Rest == nil || function.Rest.Value != tt.expectedRest) {
+			t.Errorf("wrong rest parameter. expected=%q, got=%v", tt.expectedRest, function.Rest)
+		}
+	}
+}
+
+func TestSpreadExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(...args)", "f(...args)"},
+		{"f(1, ...a + b, 2)", "f(1, ...(a + b), 2)"},
+		{"[0, ...xs, ...ys]", "[0, ...xs, ...ys]"},
+		{`{...defaults, "k": 1, ...overrides}`, `{...defaults, k:1, ...overrides}`},
+		{"{...f(x)}", "{...f(x)}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -725,6 +1410,10 @@ func TestParsingArrayLiterals(t *testing.T) {
 		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
 	}
 
+	if array.TokenLiteral() != "[" || array.Span().Start.String() != "1:1" {
+		t.Errorf("wrong array token. got=%q at %s", array.TokenLiteral(), array.Span().Start)
+	}
+
 	if len(array.Elements) != 3 {
 		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
 	}
@@ -931,6 +1620,330 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 += 1", "cannot assign to 5"},
+		{"(a + b)++", "cannot assign to (a + b)"},
+		{"++5", "cannot assign to 5"},
+		{"--f()", "cannot assign to f()"},
+		{"a ? b : c /= 2", "cannot assign to (a ? b : c)"},
+		{"1 = 2", "cannot assign to 1"},
+		{"f() = 1", "cannot assign to f()"},
+		{"let x = y + 1 = 2", "cannot assign to (y + 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got=%d", tt.input, len(p.Errors()))
+		}
+
+		d := p.Errors()[0]
+		if d.Code != diagnostic.InvalidTarget {
+			t.Errorf("%q: wrong code. expected=%s, got=%s", tt.input, diagnostic.InvalidTarget, d.Code)
+		}
+		if d.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. expected=%q, got=%q", tt.input, tt.expectedMessage, d.Message)
+		}
+	}
+
+	// Targets holding a sub-expression that failed to parse must be reported without formatting them
+	brokenTargets := []string{
+		"++-",
+		"1 - + += 1",
+		"[ ... = ] += x",
+		`"a${ - ] }" + , += 1`,
+		"x = \n ? % % = ] 2.5",
+	}
+	for _, input := range brokenTargets {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors, got none", input)
+		}
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart string
+		expectedEnd   string
+	}{
+		{"let x = 5;", "1:1", "1:10"},
+		{"return  a * b;", "1:1", "1:14"},
+		{"a + b", "1:1", "1:6"},
+		{"-foo", "1:1", "1:5"},
+		{"add(1, 22)", "1:1", "1:11"},
+		{"arr[10]", "1:1", "1:8"},
+		{"if (x) {\n  y\n}", "1:1", "3:2"},
+		{"fn(x) {\n\tx * 2\n}", "1:1", "3:2"},
+		{"[1, 2]", "1:1", "1:7"},
+		{"[]", "1:1", "1:3"},
+		{`{"a": 1 }`, "1:1", "1:10"},
+		{"f()", "1:1", "1:4"},
+		{"if (x) { 1 } else if (y) { 2 } else { 3 }", "1:1", "1:42"},
+		{"while (x) { y }", "1:1", "1:16"},
+		{"for (let i = 0; i < 3; i++) { }", "1:1", "1:32"},
+		{"for (x in xs) {\n}", "1:1", "2:2"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		span := program.Statements[0].Span()
+		if span.Start.String() != tt.expectedStart {
+			t.Errorf("%q: wrong start position. expected=%s, got=%s", tt.input, tt.expectedStart, span.Start)
+		}
+		if span.End.String() != tt.expectedEnd {
+			t.Errorf("%q: wrong end position. expected=%s, got=%s", tt.input, tt.expectedEnd, span.End)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	input := "let x = 5;\nlet = 10;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "2:5: expected next token to be IDENT, got = instead"
+	if p.Errors()[0].String() != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, p.Errors()[0])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedCode     diagnostic.Code
+		expectedExpected []token.TokenType
+		expectedFound    token.TokenType
+		expectedMessage  string
+	}{
+		{
+			"let x 5;",
+			diagnostic.UnexpectedToken,
+			[]token.TokenType{token.ASSIGN},
+			token.INT,
+			"expected next token to be =, got INT instead",
+		},
+		{
+			"(1 + 2",
+			diagnostic.UnexpectedToken,
+			[]token.TokenType{token.RPAREN},
+			token.EOF,
+			"expected next token to be ), got EOF instead",
+		},
+		{
+			"let x = @;",
+			diagnostic.IllegalToken,
+			nil,
+			token.ILLEGAL,
+			"unexpected character '@'",
+		},
+		{
+			"let x = ;",
+			diagnostic.ExpectedExpression,
+			nil,
+			token.SEMICOLON,
+			"no prefix parse function for ';' found",
+		},
+		{
+			"let mask = 0b102;",
+			diagnostic.IllegalToken,
+			nil,
+			token.ILLEGAL,
+			"invalid digit '2' in binary literal",
+		},
+		{
+			"let x = 1; /* oops",
+			diagnostic.IllegalToken,
+			nil,
+			token.ILLEGAL,
+			"unterminated block comment",
+		},
+		{
+			`let s = "C:\path";`,
+			diagnostic.IllegalToken,
+			nil,
+			token.ILLEGAL,
+			`invalid escape sequence \p`,
+		},
+		{
+			"1e400",
+			diagnostic.InvalidFloat,
+			nil,
+			token.FLOAT,
+			"could not parse \"1e400\" as float",
+		},
+		{
+			"let 0x = 1;",
+			diagnostic.IllegalToken,
+			[]token.TokenType{token.IDENT},
+			token.ILLEGAL,
+			`hexadecimal literal "0x" has no digits`,
+		},
+		{
+			"let x = (1 @);",
+			diagnostic.IllegalToken,
+			[]token.TokenType{token.RPAREN},
+			token.ILLEGAL,
+			"unexpected character '@'",
+		},
+		{
+			"fn(a = 1, b) {}",
+			diagnostic.InvalidParameter,
+			nil,
+			token.IDENT,
+			"parameter b without default value follows a parameter with one",
+		},
+		{
+			"fn(...rest, a) {}",
+			diagnostic.UnexpectedToken,
+			[]token.TokenType{token.RPAREN},
+			token.COMMA,
+			"expected next token to be ), got , instead",
+		},
+		{
+			"fn(...rest = []) {}",
+			diagnostic.UnexpectedToken,
+			[]token.TokenType{token.RPAREN},
+			token.ASSIGN,
+			"expected next token to be ), got = instead",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Fatalf("%q: expected parser errors, got none", tt.input)
+		}
+
+		d := p.Errors()[0]
+		if d.Severity != diagnostic.Error {
+			t.Errorf("%q: wrong severity. expected=%s, got=%s", tt.input, diagnostic.Error, d.Severity)
+		}
+		if d.Code != tt.expectedCode {
+			t.Errorf("%q: wrong code. expected=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+		if fmt.Sprint(d.Expected) != fmt.Sprint(tt.expectedExpected) {
+			t.Errorf("%q: wrong expected tokens. expected=%v, got=%v", tt.input, tt.expectedExpected, d.Expected)
+		}
+		if d.Found != tt.expectedFound {
+			t.Errorf("%q: wrong found token. expected=%s, got=%s", tt.input, tt.expectedFound, d.Found)
+		}
+		if d.Message != tt.expectedMessage {
+			t.Errorf("%q: wrong message. expected=%q, got=%q", tt.input, tt.expectedMessage, d.Message)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements []string
+	}{
+		{
+			"let = 5; let y = 10; y",
+			[]string{"1:5: expected next token to be IDENT, got = instead"},
+			[]string{"<bad statement>", "let y = 10;", "y"},
+		},
+		{
+			"let x = (1 + ; let y = ); z",
+			[]string{
+				"1:14: no prefix parse function for ';' found",
+				"1:24: no prefix parse function for ')' found",
+			},
+			[]string{"<bad statement>", "<bad statement>", "z"},
+		},
+		{
+			"let f = fn(x) { let = 1; x }; f(2)",
+			[]string{"1:21: expected next token to be IDENT, got = instead"},
+			[]string{"let f = fn(x) <bad statement>x;", "f(2)"},
+		},
+		{
+			"fn(1, +) { 1 } let a = 1",
+			[]string{"1:4: expected next token to be IDENT, got INT instead"},
+			[]string{"<bad statement>", "let a = 1;"},
+		},
+		{
+			"if (x { y } let a = 2",
+			[]string{"1:7: expected next token to be ), got { instead"},
+			[]string{"<bad statement>", "let a = 2;"},
+		},
+		{
+			"} let a = 3",
+			[]string{"1:1: no prefix parse function for '}' found"},
+			[]string{"<bad statement>", "let a = 3;"},
+		},
+		{
+			"let f = fn() { 1",
+			[]string{"1:17: expected next token to be }, got EOF instead"},
+			[]string{"<bad statement>"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := make([]string, len(p.Errors()))
+		for i, err := range p.Errors() {
+			errors[i] = err.String()
+		}
+		if fmt.Sprintf("%q", errors) != fmt.Sprintf("%q", tt.expectedErrors) {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expectedErrors, errors)
+		}
+
+		statements := make([]string, len(program.Statements))
+		for i, statement := range program.Statements {
+			statements[i] = statement.String()
+		}
+		if fmt.Sprintf("%q", statements) != fmt.Sprintf("%q", tt.expectedStatements) {
+			t.Errorf("%q: wrong statements. expected=%q, got=%q", tt.input, tt.expectedStatements, statements)
+		}
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	input := "let = 5 + 2; let y = 1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.BadStatement. got=%T", program.Statements[0])
+	}
+
+	if bad.Span().Start.String() != "1:1" || bad.Span().End.String() != "1:13" {
+		t.Errorf("wrong bad statement span. got=%s-%s", bad.Span().Start, bad.Span().End)
+	}
+}
+
 func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
 	switch value := expected.(type) {
 	case int:
@@ -1007,6 +2020,14 @@ func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 	return true
 }
 
+// String of an optional node, empty when the node is missing
+func nodeString(node ast.Node) string {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return ""
+	}
+	return node.String()
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	if len(p.errors) == 0 {
 		return
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/valsov/gointerpreter/diagnostic"
 	"github.com/valsov/gointerpreter/evaluator"
 	"github.com/valsov/gointerpreter/lexer"
 	"github.com/valsov/gointerpreter/object"
@@ -26,11 +27,12 @@ func Start(in io.Reader, out io.Writer) {
 
 		line := scanner.Text()
 		l := lexer.New(line)
+		l.SetMode(lexer.NormalizeIdentifiers)
 		p := parser.New(l)
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+			printParseErrors(out, line, p.Errors())
 			continue
 		}
 
@@ -42,9 +44,7 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParseErrors(out io.Writer, errors []string) {
+func printParseErrors(out io.Writer, source string, errors []diagnostic.Diagnostic) {
 	io.WriteString(out, " --- Parser errors:\n")
-	for _, err := range errors {
-		io.WriteString(out, fmt.Sprintf("    %s\n", err))
-	}
+	diagnostic.RenderAll(out, source, errors)
 }
@@ -1,10 +1,49 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Span    Span
+}
+
+// Location of a char in the source, lines and columns are 1-based and columns are counted in runes
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+// A position is valid if it was produced by the lexer
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || p.Line == other.Line && p.Column < other.Column
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Range of source covered by a token or a node, End is exclusive
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) String() string {
+	return s.Start.String()
 }
 
 const (
@@ -12,9 +51,16 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers & literals
-	IDENT  = "IDENT"
-	INT    = "INT" // Numbers
-	STRING = "STRING"
+	IDENT   = "IDENT"
+	COMMENT = "COMMENT"
+	INT     = "INT" // Numbers
+	FLOAT   = "FLOAT"
+	STRING  = "STRING"
+
+	// String interpolation segments: "head${ expr }middle${ expr }tail"
+	TEMPLATE_HEAD   = "TEMPLATE_HEAD"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_TAIL   = "TEMPLATE_TAIL"
 
 	// Operators
 	ASSIGN   = "="
@@ -25,16 +71,40 @@ const (
 	ASTERISK = "*"
 	MODULO   = "%"
 
+	// Assignments
+	INCREMENT       = "++"
+	DECREMENT       = "--"
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	MODULO_ASSIGN   = "%="
+
 	// Comparison
 	LT     = "<"
 	GT     = ">"
+	LT_EQ  = "<="
+	GT_EQ  = ">="
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	// Bitwise
+	BIT_AND     = "&"
+	BIT_OR      = "|"
+	BIT_XOR     = "^"
+	BIT_NOT     = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
+	// Logical
+	AND = "&&"
+	OR  = "||"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	ELLIPSIS  = "..."
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -52,16 +122,26 @@ const (
 	RETURN   = "RETURN"
 	IF       = "IF"
 	ELSE     = "ELSE"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IN       = "IN"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"in":       IN,
 }
 
 func Lookup(input string) TokenType {